@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	cfg := config.Load()
+
+	var (
+		by     = pflag.StringP("by", "b", audit.ByToken, "Group usage by token, subject or document")
+		format = pflag.StringP("format", "f", "table", "Output format: table, csv or json")
+		bucket = pflag.String("bucket", cfg.AuditBucket, "Read hourly audit objects from this bucket (default from AUDIT_BUCKET)")
+		prefix = pflag.String("prefix", cfg.AuditPrefix, "Object prefix of the audit objects")
+		since  = pflag.String("since", "", "Only count views at or after this time (RFC 3339 or YYYY-MM-DD)")
+		until  = pflag.String("until", "", "Only count views before this time (RFC 3339 or YYYY-MM-DD)")
+		help   = pflag.BoolP("help", "h", false, "Show help")
+	)
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: report [flags] [audit.jsonl ...]\n\n")
+		fmt.Fprintf(os.Stderr, "Summarizes document views from audit files (\"-\" reads stdin) or the audit bucket.\n\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	if *help {
+		pflag.Usage()
+		return
+	}
+
+	sinceTime, err := parseTime(*since)
+	if err != nil {
+		log.Fatalf("Invalid --since: %v", err)
+	}
+	untilTime, err := parseTime(*until)
+	if err != nil {
+		log.Fatalf("Invalid --until: %v", err)
+	}
+	report, err := audit.NewReport(*by, sinceTime, untilTime)
+	if err != nil {
+		log.Fatalf("Invalid --by: %v", err)
+	}
+
+	switch {
+	case pflag.NArg() > 0:
+		for _, name := range pflag.Args() {
+			if err := readFile(name, report); err != nil {
+				log.Fatalf("Failed to read %s: %v", name, err)
+			}
+		}
+	case *bucket != "":
+		if err := readBucket(context.Background(), *bucket, *prefix, report); err != nil {
+			log.Fatalf("Failed to read audit bucket: %v", err)
+		}
+	default:
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	if err := writeReport(os.Stdout, *format, *by, report.Rows()); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func readFile(name string, report *audit.Report) error {
+	if name == "-" {
+		return audit.ReadEvents(os.Stdin, report.Add)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return audit.ReadEvents(f, report.Add)
+}
+
+func readBucket(ctx context.Context, bucketName, prefix string, report *audit.Report) error {
+	client, err := storage.NewClient(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	names, err := client.ListFiles(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fileInfo, err := client.GetFile(ctx, name)
+		if err != nil {
+			return err
+		}
+		err = audit.ReadEvents(fileInfo.Content, report.Add)
+		fileInfo.Content.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+type column struct {
+	name  string
+	value func(audit.Usage) string
+}
+
+// columns lists the report columns; the first names what rows are keyed by.
+func columns(by string) []column {
+	key := map[string]string{audit.ByToken: "TOKEN", audit.BySubject: "SUBJECT", audit.ByDocument: "DOCUMENT"}[by]
+	cols := []column{{key, func(u audit.Usage) string { return u.Key }}}
+	if by == audit.ByToken {
+		cols = append(cols, column{"SUBJECT", func(u audit.Usage) string { return u.Subject }})
+	}
+	if by == audit.ByDocument {
+		cols = append(cols, column{"TENANT", func(u audit.Usage) string { return u.Tenant }})
+	}
+	cols = append(cols, column{"VIEWS", func(u audit.Usage) string { return strconv.Itoa(u.Views) }})
+	if by == audit.ByDocument {
+		cols = append(cols, column{"TOKENS", func(u audit.Usage) string { return strconv.Itoa(u.Tokens) }})
+	} else {
+		cols = append(cols, column{"DOCUMENTS", func(u audit.Usage) string { return strconv.Itoa(u.Documents) }})
+	}
+	return append(cols,
+		column{"BYTES", func(u audit.Usage) string { return strconv.FormatInt(u.Bytes, 10) }},
+		column{"FIRST SEEN", func(u audit.Usage) string { return u.FirstSeen.UTC().Format(time.RFC3339) }},
+		column{"LAST SEEN", func(u audit.Usage) string { return u.LastSeen.UTC().Format(time.RFC3339) }},
+	)
+}
+
+func writeReport(w io.Writer, format, by string, rows []audit.Usage) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cols := columns(by)
+		record := make([]string, len(cols))
+		for i, col := range cols {
+			record[i] = col.name
+		}
+		cw.Write(record)
+		for _, row := range rows {
+			for i, col := range cols {
+				record[i] = col.value(row)
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		cols := columns(by)
+		for i, col := range cols {
+			fmt.Fprint(tw, col.name, sep(i, len(cols)))
+		}
+		for _, row := range rows {
+			for i, col := range cols {
+				fmt.Fprint(tw, col.value(row), sep(i, len(cols)))
+			}
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %q: expected table, csv or json", format)
+	}
+}
+
+func sep(i, n int) string {
+	if i == n-1 {
+		return "\n"
+	}
+	return "\t"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/cache"
+	"github.com/pavelanni/cloud-docs/internal/compress"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+const (
+	// adminRole is the token role required for /admin endpoints.
+	adminRole = "admin"
+	// maxPurgeBody bounds the purge request body.
+	maxPurgeBody = 1 << 20
+)
+
+type purgeRequest struct {
+	Paths    []string `json:"paths"`
+	Prefixes []string `json:"prefixes"`
+	All      bool     `json:"all"`
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// cachePurgeHandler drops cached objects by bucket path or prefix. Purging a
+// path also drops its precompressed siblings (page.html.br and so on). Paths
+// are relative to objectPrefix, and purging all only drops objects under it,
+// so a tenant can't flush another tenant's share of the cache.
+func cachePurgeHandler(objectCache *cache.MemoryCache, objectPrefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req purgeRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPurgeBody))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			http.Error(w, "Invalid purge request", http.StatusBadRequest)
+			return
+		}
+		if !req.All && len(req.Paths) == 0 && len(req.Prefixes) == 0 {
+			http.Error(w, "Nothing to purge: set paths, prefixes or all", http.StatusBadRequest)
+			return
+		}
+
+		var purged int
+		switch {
+		case req.All && objectPrefix == "":
+			purged = objectCache.PurgeAll()
+		case req.All:
+			purged = objectCache.Purge(nil, []string{objectPrefix})
+		default:
+			var paths []string
+			for _, path := range req.Paths {
+				path = objectPrefix + strings.TrimPrefix(path, "/")
+				paths = append(paths, path)
+				for _, encoding := range compress.Encodings {
+					paths = append(paths, path+compress.Extension(encoding))
+				}
+			}
+			prefixes := make([]string, len(req.Prefixes))
+			for i, prefix := range req.Prefixes {
+				prefixes[i] = objectPrefix + strings.TrimPrefix(prefix, "/")
+			}
+			purged = objectCache.Purge(paths, prefixes)
+		}
+
+		logging.FromContext(r.Context()).Info("Cache purge", "paths", len(req.Paths), "prefixes", len(req.Prefixes), "all", req.All, "purged", purged)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(purgeResponse{Purged: purged})
+	}
+}
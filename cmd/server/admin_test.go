@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/cache"
+)
+
+func TestCachePurgeHandler(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"course/index.html":    {content: "<h1>Course</h1>", contentType: "text/html"},
+		"course/index.html.br": {content: "br", contentType: "text/html"},
+		"course/lab.html":      {content: "<h1>Lab</h1>", contentType: "text/html"},
+		"other/index.html":     {content: "<h1>Other</h1>", contentType: "text/html"},
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedPurged int
+	}{
+		{"path with precompressed sibling", `{"paths":["/course/index.html"]}`, http.StatusOK, 2},
+		{"prefix", `{"prefixes":["course/"]}`, http.StatusOK, 3},
+		{"all", `{"all":true}`, http.StatusOK, 4},
+		{"empty request", `{}`, http.StatusBadRequest, 0},
+		{"unknown field", `{"path":"course/index.html"}`, http.StatusBadRequest, 0},
+		{"malformed", `paths=course`, http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objectCache := cache.NewMemoryCache(backend, cache.Options{MaxBytes: 1 << 20, MaxObjectSize: 1 << 10, TTL: time.Minute})
+			for name := range backend.objects {
+				fileInfo, err := objectCache.GetFile(context.Background(), name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, fileInfo.Content)
+			}
+
+			req := httptest.NewRequest("POST", "/admin/cache/purge", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			cachePurgeHandler(objectCache, "").ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				return
+			}
+
+			var resp purgeResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Purged != tt.expectedPurged {
+				t.Errorf("Expected %d purged, got %d", tt.expectedPurged, resp.Purged)
+			}
+			if entries := objectCache.Stats().Entries; entries != 4-tt.expectedPurged {
+				t.Errorf("Expected %d entries left, got %d", 4-tt.expectedPurged, entries)
+			}
+		})
+	}
+}
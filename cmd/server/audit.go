@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// newAuditSink builds the configured audit sink, or returns nil when auditing
+// is off.
+func newAuditSink(ctx context.Context, cfg *config.Config) (audit.Sink, error) {
+	switch cfg.AuditSink {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return audit.NewWriterSink(os.Stdout), nil
+	case "file":
+		return audit.NewFileSink(cfg.AuditFile)
+	case "bucket":
+		client, err := storage.NewClient(ctx, cfg.AuditBucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit bucket client: %w", err)
+		}
+		return &closingSink{Sink: audit.NewBucketSink(client, cfg.AuditPrefix, cfg.AuditFlushInterval), client: client}, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q: expected none, stdout, file or bucket", cfg.AuditSink)
+	}
+}
+
+// closingSink closes the audit bucket client after the final upload.
+type closingSink struct {
+	audit.Sink
+	client *storage.Client
+}
+
+func (s *closingSink) Close() error {
+	err := s.Sink.Close()
+	s.client.Close()
+	return err
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+)
+
+func TestNewAuditSink(t *testing.T) {
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	tests := []struct {
+		name     string
+		cfg      *config.Config
+		wantSink bool
+		wantErr  bool
+	}{
+		{"disabled", &config.Config{AuditSink: "none"}, false, false},
+		{"stdout", &config.Config{AuditSink: "stdout"}, true, false},
+		{"file", &config.Config{AuditSink: "file", AuditFile: auditFile}, true, false},
+		{"unknown", &config.Config{AuditSink: "syslog"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := newAuditSink(context.Background(), tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAuditSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (sink != nil) != tt.wantSink {
+				t.Fatalf("newAuditSink() sink = %v, want sink %v", sink, tt.wantSink)
+			}
+			if sink != nil {
+				sink.Close()
+			}
+		})
+	}
+}
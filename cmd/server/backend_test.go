@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+type memoryObject struct {
+	content     string
+	contentType string
+	etag        string
+	updated     time.Time
+}
+
+// memoryBackend is a storage.Backend serving objects from a map. reads counts
+// Read calls on returned content so tests can tell whether data was fetched.
+type memoryBackend struct {
+	objects map[string]memoryObject
+	reads   int
+}
+
+func newMemoryBackend(objects map[string]memoryObject) *memoryBackend {
+	return &memoryBackend{objects: objects}
+}
+
+func (b *memoryBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	objectPath = strings.TrimPrefix(objectPath, "/")
+	obj, ok := b.objects[objectPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+	}
+
+	return &storage.FileInfo{
+		Content:     &countingContent{ReadSeeker: strings.NewReader(obj.content), reads: &b.reads},
+		ContentType: obj.contentType,
+		Size:        int64(len(obj.content)),
+		ETag:        obj.etag,
+		Updated:     obj.updated,
+	}, nil
+}
+
+type countingContent struct {
+	io.ReadSeeker
+	reads *int
+}
+
+func (c *countingContent) Read(p []byte) (int, error) {
+	*c.reads++
+	return c.ReadSeeker.Read(p)
+}
+
+func (c *countingContent) Close() error {
+	return nil
+}
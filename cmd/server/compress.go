@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/compress"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// serveFile writes fileInfo with http.ServeContent, choosing a compressed
+// representation when the client accepts one: a precompressed sibling object
+// (page.html.br, app.js.gz) when it exists, otherwise on-the-fly compression
+// of text types. Callers set Content-Type and caching headers beforehand.
+func serveFile(ctx context.Context, w http.ResponseWriter, r *http.Request, backend storage.Backend, objectPath string, fileInfo *storage.FileInfo, cfg *config.Config) {
+	if !cfg.CompressionEnabled || !compress.Compressible(fileInfo.ContentType) {
+		setValidators(w, fileInfo)
+		http.ServeContent(w, r, objectPath, fileInfo.Updated, fileInfo.Content)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+	encodings := compress.Negotiate(r.Header.Get("Accept-Encoding"))
+
+	if cfg.PrecompressedLookup {
+		for _, encoding := range encodings {
+			variant, err := backend.GetFile(ctx, objectPath+compress.Extension(encoding))
+			if err != nil {
+				if !errors.Is(err, storage.ErrNotFound) {
+					logging.FromContext(ctx).Warn("Error looking up precompressed variant", "object", objectPath, "encoding", encoding, "error", err)
+				}
+				continue
+			}
+			defer variant.Content.Close()
+
+			// Ranges and validators now refer to the encoded object
+			w.Header().Set("Content-Encoding", encoding)
+			setValidators(w, variant)
+			http.ServeContent(w, r, objectPath, variant.Updated, variant.Content)
+			return
+		}
+	}
+
+	if len(encodings) == 0 || fileInfo.Size < int64(cfg.CompressionMinSize) {
+		setValidators(w, fileInfo)
+		http.ServeContent(w, r, objectPath, fileInfo.Updated, fileInfo.Content)
+		return
+	}
+
+	encoding := encodings[0]
+	if etag := entityTag(fileInfo); etag != "" {
+		// Weak, since the encoded bytes depend on the compressor
+		w.Header().Set("ETag", "W/"+strings.TrimSuffix(etag, `"`)+"-"+encoding+`"`)
+	}
+
+	// The encoded length isn't known up front, so byte ranges can't be
+	// honoured; serve the whole compressed representation instead
+	r = r.WithContext(r.Context())
+	r.Header = r.Header.Clone()
+	r.Header.Del("Range")
+
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+	defer func() {
+		if err := cw.Close(); err != nil {
+			logging.FromContext(ctx).Warn("Error compressing response", "object", objectPath, "error", err)
+		}
+	}()
+	http.ServeContent(cw, r, objectPath, fileInfo.Updated, fileInfo.Content)
+}
+
+// compressWriter compresses 200 responses. The encoder is created on the
+// first Write so HEAD and bodiless responses stay empty.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	compressing bool
+	encoder     io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if status == http.StatusOK {
+		cw.compressing = true
+		cw.Header().Del("Content-Length")
+		cw.Header().Set("Content-Encoding", cw.encoding)
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.compressing {
+		return cw.ResponseWriter.Write(p)
+	}
+	if cw.encoder == nil {
+		encoder, err := compress.NewWriter(cw.ResponseWriter, cw.encoding)
+		if err != nil {
+			return 0, err
+		}
+		cw.encoder = encoder
+	}
+	return cw.encoder.Write(p)
+}
+
+func (cw *compressWriter) Close() error {
+	if cw.encoder == nil {
+		return nil
+	}
+	return cw.encoder.Close()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+)
+
+func TestServeFileCompression(t *testing.T) {
+	page := strings.Repeat("<p>Kafka partitions and consumer groups</p>\n", 100)
+	backend := newMemoryBackend(map[string]memoryObject{
+		"chapter.html":    {content: page, contentType: "text/html; charset=utf-8", etag: "page1"},
+		"chapter.html.br": {content: "precompressed-brotli", contentType: "application/x-brotli", etag: "page1br"},
+		"small.html":      {content: "<p>hi</p>", contentType: "text/html; charset=utf-8"},
+		"diagram.png":     {content: strings.Repeat("x", 4096), contentType: "image/png"},
+	})
+	cfg := &config.Config{
+		DocsPath:            "/docs",
+		CompressionEnabled:  true,
+		CompressionMinSize:  1024,
+		PrecompressedLookup: true,
+	}
+	handler := fileHandler(backend, cfg)
+
+	tests := []struct {
+		name             string
+		path             string
+		acceptEncoding   string
+		expectedEncoding string
+		expectedETag     string
+		expectedBody     string
+	}{
+		{"precompressed brotli preferred", "/docs/chapter.html", "gzip, br", "br", `"page1br"`, "precompressed-brotli"},
+		{"on-the-fly gzip without variant", "/docs/chapter.html", "gzip", "gzip", `W/"page1-gzip"`, page},
+		{"identity when not accepted", "/docs/chapter.html", "", "", `"page1"`, page},
+		{"small files not compressed", "/docs/small.html", "gzip", "", "", "<p>hi</p>"},
+		{"images not compressed", "/docs/diagram.png", "gzip, br", "", "", strings.Repeat("x", 4096)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, got)
+			}
+			if got := rr.Header().Get("ETag"); got != tt.expectedETag {
+				t.Errorf("Expected ETag %q, got %q", tt.expectedETag, got)
+			}
+			if got := rr.Header().Get("Content-Type"); got != backend.objects[strings.TrimPrefix(tt.path, "/docs/")].contentType {
+				t.Errorf("Content-Type should stay the original type, got %q", got)
+			}
+
+			body := rr.Body.String()
+			if tt.expectedEncoding == "gzip" {
+				if rr.Header().Get("Content-Length") != "" {
+					t.Error("Content-Length must not be set for on-the-fly compression")
+				}
+				zr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded, _ := io.ReadAll(zr)
+				body = string(decoded)
+			}
+			if body != tt.expectedBody {
+				t.Errorf("Unexpected body (%d bytes)", len(body))
+			}
+
+			compressible := !strings.HasSuffix(tt.path, ".png")
+			if got := rr.Header().Get("Vary"); compressible && got != "Accept-Encoding" {
+				t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+			}
+		})
+	}
+}
+
+func TestServeFileCompressionHeadAndRange(t *testing.T) {
+	page := strings.Repeat("<p>Consumer lag</p>\n", 200)
+	backend := newMemoryBackend(map[string]memoryObject{
+		"lag.html": {content: page, contentType: "text/html; charset=utf-8", etag: "lag"},
+	})
+	cfg := &config.Config{DocsPath: "/docs", CompressionEnabled: true, CompressionMinSize: 1024}
+	handler := fileHandler(backend, cfg)
+
+	req := httptest.NewRequest("HEAD", "/docs/lag.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Body.Len() != 0 {
+		t.Errorf("Expected empty HEAD body, got %d bytes", rr.Body.Len())
+	}
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("Expected HEAD to advertise gzip, got %q", rr.Header().Get("Content-Encoding"))
+	}
+
+	req = httptest.NewRequest("GET", "/docs/lag.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-9")
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected ranges to be ignored for on-the-fly compression, got %d", rr.Code)
+	}
+	if req.Header.Get("Range") == "" {
+		t.Error("Handler must not modify the caller's request headers")
+	}
+}
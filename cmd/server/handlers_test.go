@@ -1,10 +1,16 @@
 package main
 
 import (
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
 )
 
 func TestHealthHandler(t *testing.T) {
@@ -63,4 +69,231 @@ func TestRootHandler(t *testing.T) {
 		t.Errorf("handler returned wrong content type: got %v want %v",
 			contentType, "text/plain")
 	}
-}
\ No newline at end of file
+}
+
+func TestFileHandlerRange(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"lecture.mp4": {content: "0123456789abcdefghij", contentType: "video/mp4"},
+	})
+	handler := fileHandler(backend, &config.Config{DocsPath: "/docs"})
+
+	tests := []struct {
+		name           string
+		rangeHeader    string
+		expectedStatus int
+		expectedBody   string
+		expectedRange  string
+	}{
+		{"full content", "", http.StatusOK, "0123456789abcdefghij", ""},
+		{"first bytes", "bytes=0-4", http.StatusPartialContent, "01234", "bytes 0-4/20"},
+		{"open-ended", "bytes=15-", http.StatusPartialContent, "fghij", "bytes 15-19/20"},
+		{"suffix", "bytes=-3", http.StatusPartialContent, "hij", "bytes 17-19/20"},
+		{"unsatisfiable", "bytes=50-60", http.StatusRequestedRangeNotSatisfiable, "", "bytes */20"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/lecture.mp4", nil)
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Range"); got != tt.expectedRange {
+				t.Errorf("Expected Content-Range %q, got %q", tt.expectedRange, got)
+			}
+			if got := rr.Header().Get("Accept-Ranges"); rr.Code < 300 && got != "bytes" {
+				t.Errorf("Expected Accept-Ranges bytes, got %q", got)
+			}
+		})
+	}
+}
+
+func TestFileHandlerMultipartRange(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"manual.pdf": {content: "0123456789abcdefghij", contentType: "application/pdf"},
+	})
+	handler := fileHandler(backend, &config.Config{DocsPath: "/docs"})
+
+	req := httptest.NewRequest("GET", "/docs/manual.pdf", nil)
+	req.Header.Set("Range", "bytes=0-1,10-11")
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status 206, got %d", rr.Code)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Expected multipart/byteranges, got %q", rr.Header().Get("Content-Type"))
+	}
+
+	reader := multipart.NewReader(rr.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.Header.Get("Content-Type") != "application/pdf" {
+			t.Errorf("Unexpected part content type %q", part.Header.Get("Content-Type"))
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, string(data))
+	}
+
+	if len(parts) != 2 || parts[0] != "01" || parts[1] != "ab" {
+		t.Errorf("Unexpected parts %v", parts)
+	}
+}
+
+func TestConditionalGet(t *testing.T) {
+	updated := time.Date(2025, 8, 9, 19, 34, 10, 0, time.UTC)
+	backend := newMemoryBackend(map[string]memoryObject{
+		"chapter1.html":   {content: "<h1>Chapter 1</h1>", contentType: "text/html; charset=utf-8", etag: "CJ+nlN7/+YADEAE=", updated: updated},
+		"static/main.css": {content: "body{}", contentType: "text/css; charset=utf-8", etag: "CKr5qN7/+YADEAE=", updated: updated},
+	})
+	cfg := &config.Config{DocsPath: "/docs"}
+
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		path           string
+		headers        map[string]string
+		expectedStatus int
+		expectedETag   string
+	}{
+		{"document without validators", fileHandler(backend, cfg), "/docs/chapter1.html", nil, http.StatusOK, `"CJ+nlN7/+YADEAE="`},
+		{"document matching etag", fileHandler(backend, cfg), "/docs/chapter1.html", map[string]string{"If-None-Match": `"CJ+nlN7/+YADEAE="`}, http.StatusNotModified, `"CJ+nlN7/+YADEAE="`},
+		{"document stale etag", fileHandler(backend, cfg), "/docs/chapter1.html", map[string]string{"If-None-Match": `"old"`}, http.StatusOK, `"CJ+nlN7/+YADEAE="`},
+		{"document not modified since", fileHandler(backend, cfg), "/docs/chapter1.html", map[string]string{"If-Modified-Since": updated.Format(http.TimeFormat)}, http.StatusNotModified, `"CJ+nlN7/+YADEAE="`},
+		{"document modified since", fileHandler(backend, cfg), "/docs/chapter1.html", map[string]string{"If-Modified-Since": updated.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK, `"CJ+nlN7/+YADEAE="`},
+		{"static matching etag", staticFileHandler(backend, cfg), "/docs/static/main.css", map[string]string{"If-None-Match": `"CKr5qN7/+YADEAE="`}, http.StatusNotModified, `"CKr5qN7/+YADEAE="`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.reads = 0
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("ETag"); got != tt.expectedETag {
+				t.Errorf("Expected ETag %q, got %q", tt.expectedETag, got)
+			}
+			if got := rr.Header().Get("Last-Modified"); rr.Code == http.StatusOK && got != updated.Format(http.TimeFormat) {
+				t.Errorf("Expected Last-Modified %q, got %q", updated.Format(http.TimeFormat), got)
+			}
+			if tt.expectedStatus == http.StatusNotModified && backend.reads != 0 {
+				t.Errorf("Expected no content reads for 304, got %d", backend.reads)
+			}
+		})
+	}
+}
+
+func TestHeadRequest(t *testing.T) {
+	updated := time.Date(2025, 8, 9, 19, 34, 10, 0, time.UTC)
+	backend := newMemoryBackend(map[string]memoryObject{
+		"guide.html":    {content: "<h1>Guide</h1>", contentType: "text/html; charset=utf-8", etag: "abc", updated: updated},
+		"static/app.js": {content: "console.log(1)", contentType: "text/javascript; charset=utf-8", etag: "def", updated: updated},
+	})
+	cfg := &config.Config{DocsPath: "/docs"}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		path    string
+	}{
+		{"document", fileHandler(backend, cfg), "/docs/guide.html"},
+		{"static asset", staticFileHandler(backend, cfg), "/docs/static/app.js"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			get := httptest.NewRecorder()
+			tt.handler(get, httptest.NewRequest("GET", tt.path, nil))
+
+			backend.reads = 0
+			head := httptest.NewRecorder()
+			tt.handler(head, httptest.NewRequest("HEAD", tt.path, nil))
+
+			if head.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", head.Code)
+			}
+			if head.Body.Len() != 0 {
+				t.Errorf("Expected empty body, got %q", head.Body.String())
+			}
+			if backend.reads != 0 {
+				t.Errorf("Expected no content reads for HEAD, got %d", backend.reads)
+			}
+
+			for _, header := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified", "Cache-Control", "Accept-Ranges"} {
+				if head.Header().Get(header) != get.Header().Get(header) {
+					t.Errorf("%s: HEAD %q, GET %q", header, head.Header().Get(header), get.Header().Get(header))
+				}
+			}
+		})
+	}
+}
+
+func TestFileHandlerErrorPages(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"_errors/404.html": {content: "<h1>{{.Title}}</h1><p>{{.Support}}</p>", contentType: "text/html"},
+	})
+	cfg := &config.Config{DocsPath: "/docs", ErrorPagesPrefix: "_errors/", SupportContact: "help@example.com"}
+	handler := fileHandler(backend, cfg)
+
+	tests := []struct {
+		name         string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{"browser", "text/html,*/*;q=0.8", "text/html; charset=utf-8", "<h1>Page not found</h1><p>help@example.com</p>"},
+		{"api client", "application/json", "application/json", `"error":"File not found"`},
+		{"plain", "", "text/plain; charset=utf-8", "File not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/missing.html", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			rr := httptest.NewRecorder()
+			handler(rr, req)
+
+			if rr.Code != http.StatusNotFound {
+				t.Fatalf("Expected status 404, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.expectedType, got)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+// frameAncestorsPolicy builds the Content-Security-Policy value that limits
+// which pages may embed a document. Origins carried by the request's token
+// replace the deployment-wide list, so a customer's token only renders inside
+// that customer's LMS.
+func frameAncestorsPolicy(r *http.Request, defaults []string) string {
+	sources := defaults
+	if t := auth.GetTokenFromContext(r.Context()); t != nil && len(t.Origins) > 0 {
+		sources = nil
+		for _, origin := range t.Origins {
+			// Tokens are validated at generation time; never echo anything
+			// that could break out of the header value.
+			if token.ValidOrigin(origin) {
+				sources = append(sources, origin)
+			}
+		}
+	}
+
+	if len(sources) == 0 {
+		return "frame-ancestors 'none'"
+	}
+	return "frame-ancestors " + strings.Join(sources, " ")
+}
+
+// sameOriginOnly reports whether sources keep every other origin, such as
+// an LMS, from embedding documents.
+func sameOriginOnly(sources []string) bool {
+	for _, source := range sources {
+		if source != "'self'" && source != "'none'" {
+			return false
+		}
+	}
+	return true
+}
+
+// setResponseHeaders adds the configured RESPONSE_HEADERS, replacing any
+// default with the same name.
+func setResponseHeaders(w http.ResponseWriter, headers map[string]string) {
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+}
+
+// entityTag returns a strong HTTP ETag for the stored object, preferring the
+// backend's entity tag and falling back to the object generation.
+func entityTag(fileInfo *storage.FileInfo) string {
+	switch {
+	case fileInfo.ETag != "":
+		return `"` + strings.Trim(fileInfo.ETag, `"`) + `"`
+	case fileInfo.Generation != 0:
+		return fmt.Sprintf(`"%d"`, fileInfo.Generation)
+	default:
+		return ""
+	}
+}
+
+// setValidators emits ETag so ServeContent can answer If-None-Match and
+// If-Range; Last-Modified is set by ServeContent from fileInfo.Updated.
+func setValidators(w http.ResponseWriter, fileInfo *storage.FileInfo) {
+	if etag := entityTag(fileInfo); etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+}
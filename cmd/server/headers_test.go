@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+func TestFrameAncestorsPolicy(t *testing.T) {
+	defaults := []string{"'self'", "https://lms.example.com"}
+
+	tests := []struct {
+		name     string
+		token    *token.Token
+		expected string
+	}{
+		{
+			name:     "no token uses deployment list",
+			expected: "frame-ancestors 'self' https://lms.example.com",
+		},
+		{
+			name:     "token without origins uses deployment list",
+			token:    &token.Token{ID: "t1"},
+			expected: "frame-ancestors 'self' https://lms.example.com",
+		},
+		{
+			name:     "token origins override deployment list",
+			token:    &token.Token{ID: "t2", Origins: []string{"https://acme.lms.example"}},
+			expected: "frame-ancestors https://acme.lms.example",
+		},
+		{
+			name:     "invalid token origins are dropped",
+			token:    &token.Token{ID: "t3", Origins: []string{"https://a.example; script-src *"}},
+			expected: "frame-ancestors 'none'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/index.html", nil)
+			if tt.token != nil {
+				req = req.WithContext(context.WithValue(req.Context(), auth.TokenContextKey, tt.token))
+			}
+
+			if result := frameAncestorsPolicy(req, defaults); result != tt.expected {
+				t.Errorf("frameAncestorsPolicy() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSameOriginOnly(t *testing.T) {
+	tests := []struct {
+		sources  []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"'self'"}, true},
+		{[]string{"'none'"}, true},
+		{[]string{"'self'", "https://lms.example.com"}, false},
+		{[]string{"*"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := sameOriginOnly(tt.sources); got != tt.expected {
+			t.Errorf("sameOriginOnly(%q) = %v, want %v", tt.sources, got, tt.expected)
+		}
+	}
+}
+
+func TestEntityTag(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileInfo storage.FileInfo
+		expected string
+	}{
+		{"backend etag", storage.FileInfo{ETag: "CJ+nlN7/+YADEAE=", Generation: 42}, `"CJ+nlN7/+YADEAE="`},
+		{"already quoted", storage.FileInfo{ETag: `"abc"`}, `"abc"`},
+		{"generation fallback", storage.FileInfo{Generation: 1700000000000000}, `"1700000000000000"`},
+		{"no validators", storage.FileInfo{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := entityTag(&tt.fileInfo); result != tt.expected {
+				t.Errorf("entityTag() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"index.html": {content: "<h1>Hi</h1>", contentType: "text/html"},
+	})
+	handler := fileHandler(backend, &config.Config{
+		DocsPath: "/docs",
+		ResponseHeaders: map[string]string{
+			"Strict-Transport-Security": "max-age=31536000",
+			"Cache-Control":             "no-store",
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/docs/index.html", nil))
+
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Errorf("Expected configured HSTS header, got %q", got)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Expected configured Cache-Control to replace the default, got %q", got)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// errDirectoryListing is returned for directory paths when no index file is
+// configured.
+var errDirectoryListing = errors.New("directory listing not allowed")
+
+// resolution is the outcome of mapping a request path to a stored object.
+// When redirect is set the client should retry with a trailing slash.
+type resolution struct {
+	objectPath string
+	fileInfo   *storage.FileInfo
+	redirect   bool
+}
+
+// resolveDocument finds the object for a document path. Directory paths
+// ("dir/") serve cfg.DirectoryIndex, an extensionless path that isn't an
+// object redirects to "dir/" when that directory has an index, and with
+// cfg.CleanURLs "page" also serves "page.html". The exact object always wins,
+// and bucket contents are never listed.
+func resolveDocument(ctx context.Context, storageClient storage.Backend, cfg *config.Config, requestPath string) (*resolution, error) {
+	if requestPath == "" {
+		requestPath = "index.html"
+		if cfg.DirectoryIndex != "" {
+			requestPath = cfg.DirectoryIndex
+		}
+	} else if strings.HasSuffix(requestPath, "/") {
+		if cfg.DirectoryIndex == "" {
+			return nil, errDirectoryListing
+		}
+		requestPath += cfg.DirectoryIndex
+	}
+
+	fileInfo, err := storageClient.GetFile(ctx, requestPath)
+	if err == nil {
+		return &resolution{objectPath: requestPath, fileInfo: fileInfo}, nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) || path.Ext(requestPath) != "" {
+		return nil, err
+	}
+
+	if cfg.CleanURLs {
+		candidate := requestPath + ".html"
+		fileInfo, lookupErr := storageClient.GetFile(ctx, candidate)
+		if lookupErr == nil {
+			return &resolution{objectPath: candidate, fileInfo: fileInfo}, nil
+		}
+		if !errors.Is(lookupErr, storage.ErrNotFound) {
+			return nil, lookupErr
+		}
+	}
+
+	if cfg.DirectoryIndex != "" {
+		candidate := requestPath + "/" + cfg.DirectoryIndex
+		fileInfo, lookupErr := storageClient.GetFile(ctx, candidate)
+		if lookupErr == nil {
+			fileInfo.Content.Close()
+			return &resolution{objectPath: candidate, redirect: true}, nil
+		}
+		if !errors.Is(lookupErr, storage.ErrNotFound) {
+			return nil, lookupErr
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, requestPath)
+}
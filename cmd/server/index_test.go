@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/config"
+)
+
+func TestFileHandlerIndexResolution(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"index.html":               {content: "home", contentType: "text/html"},
+		"courses/kafka/index.html": {content: "kafka", contentType: "text/html"},
+		"courses/kafka/intro.html": {content: "intro", contentType: "text/html"},
+		"courses/empty/notes.txt":  {content: "notes", contentType: "text/plain"},
+		"LICENSE":                  {content: "license", contentType: "text/plain"},
+	})
+
+	resolving := &config.Config{DocsPath: "/docs", DirectoryIndex: "index.html", CleanURLs: true}
+	strict := &config.Config{DocsPath: "/docs"}
+
+	tests := []struct {
+		name             string
+		cfg              *config.Config
+		url              string
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+	}{
+		{"root", resolving, "/docs/", http.StatusOK, "home", ""},
+		{"directory index", resolving, "/docs/courses/kafka/", http.StatusOK, "kafka", ""},
+		{"directory redirect", resolving, "/docs/courses/kafka", http.StatusMovedPermanently, "", "/docs/courses/kafka/"},
+		{"redirect keeps token", resolving, "/docs/courses/kafka?token=abc", http.StatusMovedPermanently, "", "/docs/courses/kafka/?token=abc"},
+		{"clean URL", resolving, "/docs/courses/kafka/intro", http.StatusOK, "intro", ""},
+		{"exact object wins", resolving, "/docs/LICENSE", http.StatusOK, "license", ""},
+		{"directory without index", resolving, "/docs/courses/empty/", http.StatusNotFound, "", ""},
+		{"no directory redirect without index", resolving, "/docs/courses/empty", http.StatusNotFound, "", ""},
+		{"missing", resolving, "/docs/courses/missing", http.StatusNotFound, "", ""},
+		{"strict root", strict, "/docs/", http.StatusOK, "home", ""},
+		{"strict directory", strict, "/docs/courses/kafka/", http.StatusForbidden, "", ""},
+		{"strict extensionless", strict, "/docs/courses/kafka", http.StatusNotFound, "", ""},
+		{"strict clean URL", strict, "/docs/courses/kafka/intro", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			rr := httptest.NewRecorder()
+			fileHandler(backend, tt.cfg)(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if tt.expectedBody != "" && rr.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, rr.Body.String())
+			}
+			if got := rr.Header().Get("Location"); got != tt.expectedLocation {
+				t.Errorf("Expected Location %q, got %q", tt.expectedLocation, got)
+			}
+		})
+	}
+}
+
+func TestFileHandlerPolicyOnResolvedObject(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"secret/index.html": {content: "secret", contentType: "text/html"},
+		"private.html":      {content: "private", contentType: "text/html"},
+		"guide.html":        {content: "guide", contentType: "text/html"},
+	})
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	policy := `
+default: allow
+rules:
+  - name: no-secret-index
+    effect: deny
+    paths: ["/docs/secret/index.html"]
+  - name: no-private
+    effect: deny
+    paths: ["/docs/private.html"]
+`
+	if err := os.WriteFile(policyFile, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	engine, err := auth.NewPolicyEngine(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{DocsPath: "/docs", DirectoryIndex: "index.html", CleanURLs: true}
+	handler := auth.PolicyMiddleware(engine)(fileHandler(backend, cfg))
+	// Policy paths leave out a tenant's path prefix
+	tenantCfg := &config.Config{DocsPath: "/globex/docs", RoutePrefix: "/globex", DirectoryIndex: "index.html", CleanURLs: true}
+	tenantHandler := auth.PolicyMiddleware(engine, auth.WithPathPrefix("/globex"))(fileHandler(backend, tenantCfg))
+
+	tests := []struct {
+		url            string
+		handler        http.Handler
+		expectedStatus int
+	}{
+		{"/docs/secret/", handler, http.StatusForbidden},
+		{"/docs/secret/index.html", handler, http.StatusForbidden},
+		{"/docs/private", handler, http.StatusForbidden},
+		{"/docs/guide", handler, http.StatusOK},
+		{"/globex/docs/secret/", tenantHandler, http.StatusForbidden},
+		{"/globex/docs/private.html", tenantHandler, http.StatusForbidden},
+		{"/globex/docs/private", tenantHandler, http.StatusForbidden},
+		{"/globex/docs/guide", tenantHandler, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
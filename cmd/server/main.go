@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,65 +14,205 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/cache"
 	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/errorpage"
+	"github.com/pavelanni/cloud-docs/internal/health"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/internal/metrics"
+	"github.com/pavelanni/cloud-docs/internal/ratelimit"
 	"github.com/pavelanni/cloud-docs/internal/storage"
-	"github.com/pavelanni/cloud-docs/pkg/token"
+	"github.com/pavelanni/cloud-docs/internal/tracing"
+	"github.com/pavelanni/cloud-docs/internal/webhook"
+	"github.com/spf13/pflag"
 )
 
 func main() {
-	cfg := config.Load()
+	var (
+		configFile = pflag.StringP("config", "c", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (default from CONFIG_FILE)")
+		overrides  = pflag.StringArray("set", nil, "Override a setting, e.g. --set cache_ttl=10m (repeatable)")
+	)
+	pflag.Parse()
 	
-	tokenManager := token.NewManager(cfg.TokenSecret)
+	cfg, err := config.Parse(*configFile, *overrides)
+	
+	// A LevelVar lets a reload change the level of the default logger
+	logLevel := new(slog.LevelVar)
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logLevel.Set(level)
+	slog.SetDefault(logging.New(os.Stdout, logLevel))
+	
+	// Report every problem at once rather than one per restart
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if *configFile != "" {
+		slog.Info("Loaded configuration file", "file", *configFile)
+	}
+	if cfg.IsDefaultTokenSecret() {
+		slog.Warn("Using the default token secret; set TOKEN_SECRET or TOKEN_SECRET_FILE and APP_ENV=production before deploying")
+	}
+	// The default replaced X-Frame-Options: ALLOWALL and blocks LMS iframes
+	if sameOriginOnly(cfg.FrameAncestors) {
+		slog.Warn("FRAME_ANCESTORS blocks cross-origin iframes; list the LMS origins that embed documents", "frame_ancestors", cfg.FrameAncestors)
+	}
+	for _, t := range cfg.Tenants {
+		if t.FrameAncestors != nil && sameOriginOnly(t.FrameAncestors) {
+			slog.Warn("Tenant frame_ancestors blocks cross-origin iframes", "tenant", t.Name, "frame_ancestors", t.FrameAncestors)
+		}
+	}
+	
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter, cfg.TracingSampleRatio)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	if cfg.TracingExporter != tracing.ExporterNone {
+		slog.Info("Tracing enabled", "exporter", cfg.TracingExporter, "sample_ratio", cfg.TracingSampleRatio)
+	}
 	
 	var storageClient *storage.Client
 	if cfg.BucketName != "" {
 		var err error
 		storageClient, err = storage.NewClient(context.Background(), cfg.BucketName)
 		if err != nil {
-			log.Fatalf("Failed to create storage client: %v", err)
+			fatal("Failed to create storage client", err)
 		}
 		defer storageClient.Close()
-		log.Printf("Connected to GCS bucket: %s", cfg.BucketName)
+		slog.Info("Connected to GCS bucket", "bucket", cfg.BucketName)
 	} else {
-		log.Println("No bucket configured, file serving disabled")
+		slog.Warn("No bucket configured, file serving disabled")
 	}
 	
-	r := chi.NewRouter()
+	auditSink, err := newAuditSink(context.Background(), cfg)
+	if err != nil {
+		fatal("Failed to create audit sink", err)
+	}
+	if auditSink != nil {
+		slog.Info("Audit log enabled", "sink", cfg.AuditSink)
+	}
 	
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
-	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(middleware.Heartbeat("/ping"))
+	webhooks := newWebhookDispatcher(cfg)
+	var notifier *webhook.Notifier
+	if webhooks != nil {
+		notifier = webhook.NewNotifier(webhooks)
+		slog.Info("Webhooks enabled", "endpoints", len(cfg.WebhookURLs))
+	}
 	
-	r.Get("/health", healthHandler)
-	r.Get("/", rootHandler)
+	var serverMetrics *metrics.Metrics
+	if cfg.MetricsEnabled {
+		serverMetrics = metrics.New()
+	}
 	
-	if storageClient != nil {
-		// Serve static assets (CSS, JS, images) without token for easier HTML integration
-		r.Route(cfg.DocsPath+"/static", func(r chi.Router) {
-			r.Get("/*", staticFileHandler(storageClient, cfg.DocsPath+"/static"))
+	var backend storage.Backend = storageClient
+	if storageClient != nil && serverMetrics != nil {
+		backend = serverMetrics.InstrumentBackend(storageClient)
+	}
+	
+	var diskCache *cache.DiskCache
+	if storageClient != nil && cfg.CacheDir != "" && cfg.CacheDirMaxBytes > 0 {
+		var err error
+		diskCache, err = cache.NewDiskCache(backend, cfg.CacheDir, cache.Options{
+			MaxBytes:      cfg.CacheDirMaxBytes,
+			MaxObjectSize: cfg.CacheDirMaxObjectSize,
 		})
-		
-		// Serve documents with token authentication (HTML and other content)
-		r.Route(cfg.DocsPath, func(r chi.Router) {
-			r.Use(auth.TokenMiddleware(tokenManager))
-			r.Get("/*", fileHandler(storageClient, cfg.DocsPath))
+		if err != nil {
+			fatal("Failed to create disk cache", err)
+		}
+		backend = diskCache
+		if serverMetrics != nil {
+			serverMetrics.RegisterCache("disk", diskCache.Stats)
+		}
+		slog.Info("Disk cache enabled", "dir", cfg.CacheDir, "max_bytes", cfg.CacheDirMaxBytes)
+	}
+	
+	var objectCache *cache.MemoryCache
+	if storageClient != nil && cfg.CacheMaxBytes > 0 {
+		objectCache = cache.NewMemoryCache(backend, cache.Options{
+			MaxBytes:      cfg.CacheMaxBytes,
+			MaxObjectSize: cfg.CacheMaxObjectSize,
+			TTL:           cfg.CacheTTL,
+			NegativeTTL:   cfg.CacheNegativeTTL,
 		})
+		backend = objectCache
+		if serverMetrics != nil {
+			serverMetrics.RegisterCache("memory", objectCache.Stats)
+		}
+		slog.Info("Object cache enabled", "max_bytes", cfg.CacheMaxBytes, "ttl", cfg.CacheTTL.String())
+		
+		if cfg.CacheManifestObject != "" && cfg.CacheManifestInterval > 0 {
+			manifestCtx, stopManifest := context.WithCancel(context.Background())
+			defer stopManifest()
+			go cache.WatchManifest(manifestCtx, storageClient, cfg.CacheManifestObject, cfg.CacheManifestInterval, func() {
+				slog.Info("Purged object cache after publish", "purged", objectCache.PurgeAll())
+			})
+		}
+	}
+	
+	buckets, closeTenantBuckets, err := openTenantBuckets(context.Background(), cfg, serverMetrics)
+	if err != nil {
+		fatal("Failed to create storage client", err)
+	}
+	defer closeTenantBuckets()
+	if storageClient != nil {
+		buckets[cfg.BucketName] = &bucket{backend: backend, objectCache: objectCache, client: storageClient}
+	}
+	readiness := health.NewChecker(cfg.ReadyCacheTTL, readyTimeout, readinessChecks(cfg, buckets)...)
+	svc := &services{
+		buckets:    buckets,
+		metrics:    serverMetrics,
+		rateLimits: ratelimit.NewMemoryStore(),
+		auditSink:  auditSink,
+		notifier:   notifier,
+		readiness:  readiness,
 	}
 	
+	// Routes and middleware are rebuilt on SIGHUP or when the configuration
+	// file changes; the services above carry over
+	router, err := newReloader(*configFile, *overrides, cfg, svc, logLevel)
+	if err != nil {
+		fatal("Failed to build router", err)
+	}
+	if cfg.PolicyFile != "" {
+		slog.Info("Loaded access policy", "file", cfg.PolicyFile)
+	}
+	for _, t := range cfg.Tenants {
+		slog.Info("Serving tenant", "tenant", t.Name, "hosts", t.Hosts, "path_prefix", t.PathPrefix)
+	}
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go router.Watch(reloadCtx, cfg.ConfigReloadInterval, hup)
+	
 	srv := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: r,
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	
+	if cfg.TLSEnabled() {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			fatal("Failed to configure TLS", err)
+		}
+		srv.TLSConfig = tlsConfig
 	}
 	
 	go func() {
-		log.Printf("Starting server on port %s", cfg.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		var err error
+		if cfg.TLSEnabled() {
+			slog.Info("Starting server", "port", cfg.Port, "tls", true, "auth_mode", cfg.AuthMode)
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			slog.Info("Starting server", "port", cfg.Port, "auth_mode", cfg.AuthMode)
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start server", err)
 		}
 	}()
 	
@@ -78,16 +220,87 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server")
+	readiness.Drain()
 	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 	
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		fatal("Server forced to shutdown", err)
 	}
 	
-	log.Println("Server stopped")
+	if webhooks != nil {
+		if err := webhooks.Close(ctx); err != nil {
+			slog.Warn("Failed to deliver pending webhooks", "error", err)
+		}
+		stats := webhooks.Stats()
+		slog.Info("Webhook stats", "delivered", stats.Delivered, "failed", stats.Failed, "dropped", stats.Dropped)
+	}
+	
+	if auditSink != nil {
+		if err := auditSink.Close(); err != nil {
+			slog.Error("Failed to flush audit log", "error", err)
+		}
+	}
+	
+	// Flush spans still waiting in the batcher
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Failed to flush traces", "error", err)
+	}
+	
+	if objectCache != nil {
+		logCacheStats("Object cache", objectCache.Stats())
+	}
+	if diskCache != nil {
+		logCacheStats("Disk cache", diskCache.Stats())
+	}
+	
+	slog.Info("Server stopped")
+}
+
+// fatal logs at critical severity and exits.
+func fatal(msg string, err error) {
+	slog.Log(context.Background(), logging.LevelCritical, msg, "error", err)
+	os.Exit(1)
+}
+
+func logCacheStats(name string, stats cache.Stats) {
+	slog.Info(name+" stats", "hits", stats.Hits, "misses", stats.Misses,
+		"evictions", stats.Evictions, "entries", stats.Entries, "bytes", stats.Bytes)
+}
+
+// newTLSConfig builds the server TLS settings. When a client CA is configured,
+// presented client certificates are verified against it; whether a certificate
+// is required is left to the auth middleware so /health stays reachable.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// storageContext bounds the storage calls of one request; zero leaves them
+// bounded only by the client.
+func storageContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
@@ -102,53 +315,55 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Cloud Docs Server\n")
 }
 
-func staticFileHandler(storageClient *storage.Client, staticPath string) http.HandlerFunc {
+func staticFileHandler(storageClient storage.Backend, cfg *config.Config) http.HandlerFunc {
+	staticPath := cfg.DocsPath + "/static"
+	errorPages := errorpage.New(storageClient, cfg.ErrorPagesPrefix, cfg.SupportContact)
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, staticPath+"/")
-		log.Printf("Static file request: URL=%s, trimmed path=%s", r.URL.Path, path)
+		logger := logging.FromContext(r.Context())
+		logger.Debug("Static file request", "url", r.URL.Path, "object", path)
 
 		// Only serve files from static/ directory - no index.html fallback
 		if path == "" || strings.HasSuffix(path, "/") {
-			log.Printf("Static file rejected: empty path or directory")
-			http.Error(w, "Not found", http.StatusNotFound)
+			logger.Debug("Static file rejected: empty path or directory")
+			errorPages.Error(w, r, http.StatusNotFound, "Not found")
 			return
 		}
 
 		// Prepend "static/" to the path to ensure we're serving from static directory
 		path = "static/" + path
-		log.Printf("Looking for file in storage: %s", path)
+		logger.Debug("Looking for file in storage", "object", path)
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := storageContext(r.Context(), cfg.StorageTimeout)
 		defer cancel()
 
 		fileInfo, err := storageClient.GetFile(ctx, path)
 		if err != nil {
-			log.Printf("Error getting static file %s: %v", path, err)
-			http.Error(w, "Not found", http.StatusNotFound)
+			logger.Info("Static file not served", "object", path, "error", err)
+			errorPages.Error(w, r, http.StatusNotFound, "Not found")
 			return
 		}
 		defer fileInfo.Content.Close()
-		log.Printf("Successfully serving static file: %s (size: %d bytes)", path, fileInfo.Size)
+		logger.Debug("Serving static file", "object", path, "size", fileInfo.Size)
 
 		// Security headers for static assets (but less restrictive than documents)
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("Content-Type", fileInfo.ContentType)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size))
 
 		// Public cache for static assets (since they don't contain sensitive data)
 		w.Header().Set("Cache-Control", "public, max-age=3600")
+		setResponseHeaders(w, cfg.ResponseHeaders)
 
-		// Use io.CopyN to ensure we copy exactly the expected number of bytes
-		n, err := io.CopyN(w, fileInfo.Content, fileInfo.Size)
-		if err != nil && err != io.EOF {
-			log.Printf("Error streaming static file %s: copied %d of %d bytes, error: %v", path, n, fileInfo.Size, err)
-		} else {
-			log.Printf("Successfully streamed static file %s: %d bytes", path, n)
-		}
+		// ServeContent (via serveFile) sets Content-Length, answers Range/If-Range
+		// requests and replies 304 to matching If-None-Match/If-Modified-Since.
+		// Object data is only read from storage when a body is actually sent
+		serveFile(ctx, w, r, storageClient, path, fileInfo, cfg)
 	}
 }
 
-func fileHandler(storageClient *storage.Client, docsPath string) http.HandlerFunc {
+func fileHandler(storageClient storage.Backend, cfg *config.Config) http.HandlerFunc {
+	docsPath := cfg.DocsPath
+	errorPages := errorpage.New(storageClient, cfg.ErrorPagesPrefix, cfg.SupportContact)
 	return func(w http.ResponseWriter, r *http.Request) {
 		path := strings.TrimPrefix(r.URL.Path, docsPath+"/")
 
@@ -158,41 +373,56 @@ func fileHandler(storageClient *storage.Client, docsPath string) http.HandlerFun
 			return
 		}
 
-		// Prevent directory listing - reject paths ending with / or empty paths without explicit file
-		if path == "" {
-			path = "index.html"
-		} else if strings.HasSuffix(path, "/") {
-			http.Error(w, "Directory listing not allowed", http.StatusForbidden)
-			return
-		}
+		logger := logging.FromContext(r.Context())
+		logger.Debug("Document request", "object", path)
 
-		log.Printf("Document request: path=%s", path)
-
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		ctx, cancel := storageContext(r.Context(), cfg.StorageTimeout)
 		defer cancel()
 
-		fileInfo, err := storageClient.GetFile(ctx, path)
+		// Never list directories: "dir/" only serves the configured index file
+		res, err := resolveDocument(ctx, storageClient, cfg, path)
 		if err != nil {
-			if strings.Contains(err.Error(), "file not found") {
-				http.Error(w, "File not found", http.StatusNotFound)
+			if errors.Is(err, errDirectoryListing) {
+				errorPages.Error(w, r, http.StatusForbidden, "Directory listing not allowed")
 				return
 			}
-			log.Printf("Error serving file %s: %v", path, err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			if errors.Is(err, storage.ErrNotFound) {
+				errorPages.Error(w, r, http.StatusNotFound, "File not found")
+				return
+			}
+			logger.Error("Error serving file", "object", path, "error", err)
+			errorPages.Error(w, r, http.StatusInternalServerError, "Internal server error")
+			return
+		}
+		if res.redirect {
+			// Keep the query string so ?token= survives the redirect
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
 			return
 		}
+		path, fileInfo := res.objectPath, res.fileInfo
 		defer fileInfo.Content.Close()
-		log.Printf("Serving document %s (size: %d bytes, type: %s)", path, fileInfo.Size, fileInfo.ContentType)
+
+		// The policy checked the request path; an index file or clean URL
+		// is a different object and must be allowed too
+		if allowed, rule := auth.AllowedPath(r, docsPath+"/"+path); !allowed {
+			logger.Warn("Access denied by policy", "object", path, "rule", rule)
+			errorPages.Error(w, r, http.StatusForbidden, "Access denied")
+			return
+		}
+		logger.Debug("Serving document", "object", path, "size", fileInfo.Size, "content_type", fileInfo.ContentType)
 
 		// Security headers to prevent indexing and improve security
 		w.Header().Set("X-Robots-Tag", "noindex, nofollow, noarchive, nosnippet")
 		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "ALLOWALL")
+		w.Header().Set("Content-Security-Policy", frameAncestorsPolicy(r, cfg.FrameAncestors))
 		w.Header().Set("Referrer-Policy", "no-referrer")
 
 		// Content-Type and caching based on file type
 		w.Header().Set("Content-Type", fileInfo.ContentType)
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size))
 
 		// Cache policy based on content type
 		if strings.Contains(fileInfo.ContentType, "text/html") {
@@ -201,13 +431,12 @@ func fileHandler(storageClient *storage.Client, docsPath string) http.HandlerFun
 			// CSS, JS, images - longer cache but still private since auth required
 			w.Header().Set("Cache-Control", "private, max-age=3600")
 		}
+		setResponseHeaders(w, cfg.ResponseHeaders)
 
-		// Use io.CopyN to ensure we copy exactly the expected number of bytes
-		n, err := io.CopyN(w, fileInfo.Content, fileInfo.Size)
-		if err != nil && err != io.EOF {
-			log.Printf("Error streaming file %s: copied %d of %d bytes, error: %v", path, n, fileInfo.Size, err)
-		} else {
-			log.Printf("Successfully streamed file %s: %d bytes", path, n)
-		}
+		// ServeContent (via serveFile) sets Content-Length, answers Range/If-Range
+		// requests (including multipart/byteranges) and replies 304 to matching
+		// If-None-Match/If-Modified-Since. Only the bytes actually sent are read
+		// from storage, so revalidations never download the object
+		serveFile(ctx, w, r, storageClient, path, fileInfo, cfg)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/health"
+)
+
+// readyTimeout bounds each readiness check run.
+const readyTimeout = 5 * time.Second
+
+// pinger is the part of storage.Client the readiness check uses.
+type pinger interface {
+	Ping(ctx context.Context, probeObject string) error
+}
+
+// readinessChecks lists what /ready verifies: that every bucket the sites
+// serve answers with the server's credentials and, when the server
+// terminates TLS, that its certificate hasn't expired. The configuration
+// itself was validated at startup and can't become invalid while running.
+func readinessChecks(cfg *config.Config, buckets map[string]*bucket) []health.Check {
+	checks := []health.Check{
+		{Name: "storage", Run: func(ctx context.Context) error {
+			if len(buckets) == 0 {
+				return errors.New("no bucket configured")
+			}
+			for _, name := range slices.Sorted(maps.Keys(buckets)) {
+				client := buckets[name].client
+				if client == nil {
+					continue
+				}
+				// The probe object is in the top-level bucket; tenant buckets are listed
+				probeObject := ""
+				if name == cfg.BucketName {
+					probeObject = cfg.ReadyProbeObject
+				}
+				// Details such as the service account stay in the logs
+				if err := client.Ping(ctx, probeObject); err != nil {
+					slog.Warn("Storage readiness probe failed", "bucket", name, "error", err)
+					return errors.New("bucket unreachable")
+				}
+			}
+			return nil
+		}},
+	}
+	if cfg.TLSEnabled() {
+		checks = append(checks, health.Check{Name: "certificate", Run: func(ctx context.Context) error {
+			return checkCertificate(cfg, time.Now())
+		}})
+	}
+	return checks
+}
+
+// checkCertificate fails once the server certificate has expired, since
+// clients would reject every connection.
+func checkCertificate(cfg *config.Config, now time.Time) error {
+	if !cfg.TLSEnabled() {
+		return nil
+	}
+	pair, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+	if now.After(leaf.NotAfter) {
+		return fmt.Errorf("TLS certificate expired at %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+)
+
+func writeTestCertificate(t *testing.T, notAfter time.Time) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "docs.example.com"},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Now()
+	validCert, validKey := writeTestCertificate(t, now.Add(24*time.Hour))
+	expiredCert, expiredKey := writeTestCertificate(t, now.Add(-time.Hour))
+
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		wantErr bool
+	}{
+		{"TLS disabled", &config.Config{}, false},
+		{"valid certificate", &config.Config{TLSCertFile: validCert, TLSKeyFile: validKey}, false},
+		{"expired certificate", &config.Config{TLSCertFile: expiredCert, TLSKeyFile: expiredKey}, true},
+		{"missing files", &config.Config{TLSCertFile: "missing.pem", TLSKeyFile: "missing.key"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCertificate(tt.cfg, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadinessWithoutBucket(t *testing.T) {
+	cfg := &config.Config{AuthMode: config.AuthModeToken, FrameAncestors: []string{"'self'"}}
+	checks := readinessChecks(cfg, nil)
+	if len(checks) != 1 || checks[0].Name != "storage" {
+		t.Fatalf("Expected only the storage check without TLS, got %v", checks)
+	}
+	if err := checks[0].Run(t.Context()); err == nil {
+		t.Error("Expected storage check to fail without a bucket")
+	}
+}
+
+type fakePinger struct {
+	err    error
+	probes []string
+}
+
+func (p *fakePinger) Ping(ctx context.Context, probeObject string) error {
+	p.probes = append(p.probes, probeObject)
+	return p.err
+}
+
+func TestReadinessProbesEveryBucket(t *testing.T) {
+	tests := []struct {
+		name       string
+		bucketName string
+		globexErr  error
+		wantErr    bool
+	}{
+		{"all reachable", "docs", nil, false},
+		{"tenant bucket unreachable", "docs", errors.New("permission denied"), true},
+		{"tenant buckets only", "", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{BucketName: tt.bucketName, ReadyProbeObject: "ready.txt"}
+			globex := &fakePinger{err: tt.globexErr}
+			buckets := map[string]*bucket{"globex-docs": {client: globex}}
+			var docs *fakePinger
+			if tt.bucketName != "" {
+				docs = &fakePinger{}
+				buckets[tt.bucketName] = &bucket{client: docs}
+			}
+
+			err := readinessChecks(cfg, buckets)[0].Run(t.Context())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("storage check error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// The probe object only exists in the top-level bucket
+			if len(globex.probes) != 1 || globex.probes[0] != "" {
+				t.Errorf("Expected tenant bucket to be listed once, got probes %q", globex.probes)
+			}
+			if docs != nil && (len(docs.probes) != 1 || docs.probes[0] != "ready.txt") {
+				t.Errorf("Expected top-level bucket to read the probe object, got probes %q", docs.probes)
+			}
+		})
+	}
+}
+
+func TestReadinessCertificateCheck(t *testing.T) {
+	cfg := &config.Config{TLSCertFile: "missing.pem", TLSKeyFile: "missing.key"}
+	checks := readinessChecks(cfg, nil)
+	if len(checks) != 2 || checks[1].Name != "certificate" {
+		t.Fatalf("Expected a certificate check with TLS, got %v", checks)
+	}
+	if err := checks[1].Run(t.Context()); err == nil {
+		t.Error("Expected certificate check to fail for a missing certificate")
+	}
+}
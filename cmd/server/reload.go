@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+// restartOnly lists the settings (by file key) that are wired into the
+// listener or the long-lived services. A reload keeps their running values
+// and logs that a restart is needed for the new ones.
+var restartOnly = []string{
+	"port", "bucket_name", "auth_mode",
+	"tls_cert_file", "tls_key_file", "tls_client_ca_file",
+	"read_header_timeout", "read_timeout", "write_timeout", "idle_timeout", "shutdown_timeout",
+	"cache_max_bytes", "cache_max_object_size", "cache_ttl", "cache_negative_ttl",
+	"cache_manifest_object", "cache_manifest_interval",
+	"cache_dir", "cache_dir_max_bytes", "cache_dir_max_object_size",
+	"metrics_enabled", "tracing_exporter", "tracing_sample_ratio",
+	"audit_sink", "audit_file", "audit_bucket", "audit_prefix", "audit_flush_interval",
+	"webhook_urls", "webhook_secret", "webhook_events", "webhook_queue_size",
+	"webhook_max_attempts", "webhook_timeout",
+	"ready_probe_object", "ready_cache_ttl", "config_reload_interval",
+}
+
+// reloader serves requests with the current router and replaces it when the
+// configuration is reloaded. In-flight requests finish on the router they
+// started with.
+type reloader struct {
+	path      string
+	overrides []string
+	svc       *services
+	logLevel  *slog.LevelVar
+	handler   atomic.Pointer[http.Handler]
+
+	mu          sync.Mutex
+	cfg         *config.Config
+	stopPolicy  context.CancelFunc
+	fileVersion map[string]fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// newReloader builds the first router from cfg, which must be valid.
+func newReloader(path string, overrides []string, cfg *config.Config, svc *services, logLevel *slog.LevelVar) (*reloader, error) {
+	rl := &reloader{path: path, overrides: overrides, svc: svc, logLevel: logLevel}
+	if err := rl.apply(cfg); err != nil {
+		return nil, err
+	}
+	rl.fileVersion = rl.watchedVersions()
+	return rl, nil
+}
+
+func (rl *reloader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*rl.handler.Load()).ServeHTTP(w, r)
+}
+
+// Config returns the configuration of the active router.
+func (rl *reloader) Config() *config.Config {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.cfg
+}
+
+// Reload re-reads the configuration file, environment and overrides. An
+// invalid configuration leaves the running one in place.
+func (rl *reloader) Reload() error {
+	cfg, err := config.Parse(rl.path, rl.overrides)
+	if err != nil {
+		return err
+	}
+
+	rl.mu.Lock()
+	running := rl.cfg
+	rl.mu.Unlock()
+	changed := keepRestartOnly(running, cfg)
+	// Reloadable settings can conflict with the running ones they now sit next to
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("configuration is invalid with the running restart-only settings: %w", err)
+	}
+	if len(changed) > 0 {
+		slog.Warn("Restart required for changed settings; keeping running values", "settings", changed)
+	}
+	return rl.apply(cfg)
+}
+
+// apply loads the access policy named by cfg and swaps in a router built
+// from both.
+func (rl *reloader) apply(cfg *config.Config) error {
+	var policyEngine *auth.PolicyEngine
+	stopPolicy := func() {}
+	if cfg.PolicyFile != "" {
+		var err error
+		policyEngine, err = auth.NewPolicyEngine(cfg.PolicyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load access policy: %w", err)
+		}
+		if cfg.PolicyReloadInterval > 0 {
+			var watchCtx context.Context
+			watchCtx, stopPolicy = context.WithCancel(context.Background())
+			go policyEngine.Watch(watchCtx, cfg.PolicyReloadInterval)
+		}
+	}
+
+	handler, err := newSiteHandler(cfg, rl.svc, policyEngine)
+	if err != nil {
+		stopPolicy()
+		return err
+	}
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	rl.logLevel.Set(level)
+	rl.handler.Store(&handler)
+
+	rl.mu.Lock()
+	if rl.stopPolicy != nil {
+		rl.stopPolicy()
+	}
+	rl.cfg, rl.stopPolicy = cfg, stopPolicy
+	rl.mu.Unlock()
+	return nil
+}
+
+// Watch reloads on each signal from trigger (SIGHUP) and when the
+// configuration or token secret file changes, checking every interval (zero
+// disables polling), until ctx is cancelled.
+func (rl *reloader) Watch(ctx context.Context, interval time.Duration, trigger <-chan os.Signal) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			rl.mu.Lock()
+			if rl.stopPolicy != nil {
+				rl.stopPolicy()
+			}
+			rl.mu.Unlock()
+			return
+		case <-trigger:
+			rl.reload("signal")
+		case <-tick:
+			if rl.filesChanged() {
+				rl.reload("file change")
+			}
+		}
+	}
+}
+
+// filesChanged reports whether a watched file changed since the last check,
+// so a broken file is reported once rather than on every tick.
+func (rl *reloader) filesChanged() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	versions := rl.watchedVersions()
+	if reflect.DeepEqual(versions, rl.fileVersion) {
+		return false
+	}
+	rl.fileVersion = versions
+	return true
+}
+
+func (rl *reloader) reload(reason string) {
+	if err := rl.Reload(); err != nil {
+		slog.Error("Configuration reload failed, keeping previous configuration", "reason", reason, "error", err)
+		return
+	}
+	slog.Info("Reloaded configuration", "reason", reason)
+}
+
+// watchedVersions stats the configuration file and the token secret files.
+// Callers hold rl.mu once rl.cfg is set.
+func (rl *reloader) watchedVersions() map[string]fileVersion {
+	paths := []string{rl.path, rl.cfg.TokenSecretFile}
+	for _, t := range rl.cfg.Tenants {
+		paths = append(paths, t.TokenSecretFile)
+	}
+
+	versions := map[string]fileVersion{}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			versions[path] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return versions
+}
+
+// keepRestartOnly copies the restartOnly settings from running into next and
+// returns the keys whose values differed.
+func keepRestartOnly(running, next *config.Config) []string {
+	restart := map[string]bool{}
+	for _, key := range restartOnly {
+		restart[key] = true
+	}
+
+	var changed []string
+	rv, nv := reflect.ValueOf(running).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		key := rv.Type().Field(i).Tag.Get("yaml")
+		if !restart[key] {
+			continue
+		}
+		if !reflect.DeepEqual(rv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, key)
+			nv.Field(i).Set(rv.Field(i))
+		}
+	}
+	return changed
+}
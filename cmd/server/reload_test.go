@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/ratelimit"
+)
+
+func newTestReloader(t *testing.T, configYAML string) (*reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "bucket_name: docs\n"+configYAML)
+
+	cfg, err := config.Parse(path, nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	svc := &services{
+		buckets: map[string]*bucket{"docs": {backend: newMemoryBackend(map[string]memoryObject{
+			"static/app.css": {content: "body{}", contentType: "text/css"},
+		})}},
+		rateLimits: ratelimit.NewMemoryStore(),
+	}
+	rl, err := newReloader(path, nil, cfg, svc, new(slog.LevelVar))
+	if err != nil {
+		t.Fatalf("newReloader() error = %v", err)
+	}
+	return rl, path
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func staticHeader(rl *reloader, name string) string {
+	rr := httptest.NewRecorder()
+	rl.ServeHTTP(rr, httptest.NewRequest("GET", "/docs/static/app.css", nil))
+	if rr.Code != http.StatusOK {
+		return ""
+	}
+	return rr.Header().Get(name)
+}
+
+func TestReloaderSwapsRouter(t *testing.T) {
+	rl, path := newTestReloader(t, "response_headers: {X-Release: one}\n")
+	if got := staticHeader(rl, "X-Release"); got != "one" {
+		t.Fatalf("Expected X-Release one, got %q", got)
+	}
+
+	writeFile(t, path, "bucket_name: docs\nresponse_headers: {X-Release: two}\nlog_level: debug\n")
+	if err := rl.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if got := staticHeader(rl, "X-Release"); got != "two" {
+		t.Errorf("Expected X-Release two after reload, got %q", got)
+	}
+	if rl.logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected log level debug after reload, got %v", rl.logLevel.Level())
+	}
+
+	writeFile(t, path, "bucket_name: docs\nresponse_headers: {X-Release: three}\nrate_limit_ip_rps: -1\n")
+	if err := rl.Reload(); err == nil {
+		t.Error("Expected invalid configuration to be rejected")
+	}
+	if got := staticHeader(rl, "X-Release"); got != "two" {
+		t.Errorf("Expected previous router to stay active, got X-Release %q", got)
+	}
+}
+
+func TestReloaderValidatesMergedConfig(t *testing.T) {
+	mtls := "auth_mode: mtls\ntls_cert_file: cert.pem\ntls_key_file: key.pem\ntls_client_ca_file: ca.pem\ntrusted_proxy_hops: 0\n"
+	rl, path := newTestReloader(t, mtls+"tls_allowed_clients: [portal]\nresponse_headers: {X-Release: one}\n")
+
+	// Valid on its own, but auth_mode stays mtls and would have no allow-list
+	writeFile(t, path, "bucket_name: docs\nauth_mode: token\nresponse_headers: {X-Release: two}\n")
+	err := rl.Reload()
+	if err == nil || !strings.Contains(err.Error(), "tls_allowed_clients") {
+		t.Fatalf("Expected reload to be rejected for tls_allowed_clients, got %v", err)
+	}
+	if got := rl.Config().TLSAllowedClients; len(got) != 1 {
+		t.Errorf("Expected running allow-list to stay active, got %v", got)
+	}
+}
+
+func TestReloaderWatchFile(t *testing.T) {
+	rl, path := newTestReloader(t, "response_headers: {X-Release: one}\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rl.Watch(ctx, 10*time.Millisecond, nil)
+
+	writeFile(t, path, "bucket_name: docs\nresponse_headers: {X-Release: second}\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for staticHeader(rl, "X-Release") != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("Router was not reloaded after the file changed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestKeepRestartOnly(t *testing.T) {
+	running := config.Default()
+	next := config.Default()
+	next.Port = "9000"
+	next.CacheTTL = time.Hour
+	next.FrameAncestors = []string{"https://lms.example.com"}
+
+	changed := keepRestartOnly(running, next)
+	if want := []string{"port", "cache_ttl"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("keepRestartOnly() = %v, want %v", changed, want)
+	}
+	if next.Port != "8080" || next.CacheTTL != running.CacheTTL {
+		t.Errorf("Expected running values to be kept, got port %s cache_ttl %s", next.Port, next.CacheTTL)
+	}
+	if next.FrameAncestors[0] != "https://lms.example.com" {
+		t.Errorf("Expected reloadable setting to change, got %v", next.FrameAncestors)
+	}
+}
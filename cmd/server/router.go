@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/errorpage"
+	"github.com/pavelanni/cloud-docs/internal/health"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/internal/metrics"
+	"github.com/pavelanni/cloud-docs/internal/ratelimit"
+	"github.com/pavelanni/cloud-docs/internal/tracing"
+	"github.com/pavelanni/cloud-docs/internal/webhook"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+// services are the long-lived dependencies shared by every router. A reload
+// rebuilds routes and middleware around them, so caches, rate limit buckets,
+// metrics and queued webhooks survive it.
+type services struct {
+	// buckets holds the backend chain of every bucket opened at startup,
+	// by name.
+	buckets    map[string]*bucket
+	metrics    *metrics.Metrics
+	rateLimits ratelimit.Store
+	auditSink  audit.Sink
+	notifier   *webhook.Notifier
+	readiness  *health.Checker
+}
+
+// newRouter builds the HTTP handler for one site. It expects a configuration
+// that already passed validation; policyEngine is nil without an access
+// policy. Without a bucket only the service endpoints are routed.
+func newRouter(cfg *config.Config, svc *services, policyEngine *auth.PolicyEngine) (http.Handler, error) {
+	tokenManager := token.NewManager(cfg.TokenSecret)
+	originCheck, _ := auth.ParseOriginCheckMode(cfg.OriginCheckMode)
+	ipLimit := ratelimit.Limit{Rate: cfg.RateLimitIPRate, Burst: cfg.RateLimitIPBurst}
+	tokenLimit := ratelimit.Limit{Rate: cfg.RateLimitTokenRate, Burst: cfg.RateLimitTokenBurst}
+
+	r := chi.NewRouter()
+
+	r.Use(middleware.RequestID)
+	r.Use(ratelimit.RealIP(cfg.TrustedProxyHops))
+	r.Use(logging.Middleware)
+	r.Use(tracing.Middleware)
+	if svc.metrics != nil {
+		r.Use(svc.metrics.Middleware)
+	}
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.Heartbeat("/ping"))
+
+	r.Get("/health", healthHandler)
+	if svc.readiness != nil {
+		r.Get("/ready", svc.readiness.Handler())
+	}
+	r.Get("/", rootHandler)
+
+	var tokenOpts []auth.Option
+	if svc.metrics != nil {
+		r.Handle(cfg.MetricsPath, svc.metrics.Handler())
+		tokenOpts = append(tokenOpts, auth.WithTokenObserver(svc.metrics.ObserveToken))
+	}
+
+	if cfg.BucketName == "" {
+		return r, nil
+	}
+	b, ok := svc.buckets[cfg.BucketName]
+	if !ok {
+		return nil, fmt.Errorf("bucket %s was not opened at startup, restart to serve it", cfg.BucketName)
+	}
+	backend := b.backend
+	if cfg.ObjectPrefix != "" {
+		backend = &prefixBackend{backend: backend, prefix: cfg.ObjectPrefix}
+	}
+	if len(cfg.HiddenPrefixes) > 0 {
+		backend = &hidingBackend{backend: backend, prefixes: cfg.HiddenPrefixes}
+	}
+
+	// Serve static assets (CSS, JS, images) without token for easier HTML integration
+	r.Route(cfg.DocsPath+"/static", func(r chi.Router) {
+		r.Use(ratelimit.Middleware(svc.rateLimits, ipLimit, ratelimit.ByIP))
+		// HEAD shares the GET handler; it only looks up object attributes
+		staticHandler := staticFileHandler(backend, cfg)
+		r.Get("/*", staticHandler)
+		r.Head("/*", staticHandler)
+	})
+
+	if b.objectCache != nil {
+		// Publishing tools purge stale content with an admin token
+		r.Route(cfg.RoutePrefix+"/admin", func(r chi.Router) {
+			r.Use(ratelimit.Middleware(svc.rateLimits, ipLimit, ratelimit.ByIP))
+			r.Use(auth.TokenMiddleware(tokenManager, tokenOpts...))
+			r.Use(auth.RequireRole(adminRole))
+			r.Post("/cache/purge", cachePurgeHandler(b.objectCache, cfg.ObjectPrefix))
+		})
+	}
+
+	// Readers see branded error pages inside the LMS iframe; API clients
+	// still get plain text or JSON
+	errorPages := errorpage.New(backend, cfg.ErrorPagesPrefix, cfg.SupportContact)
+	withErrorPages := auth.WithErrorHandler(errorPages.Error)
+
+	// Serve documents with token authentication (HTML and other content)
+	r.Route(cfg.DocsPath, func(r chi.Router) {
+		// Audit every access attempt, including rejected ones
+		if svc.auditSink != nil {
+			r.Use(audit.Middleware(svc.auditSink, cfg.TenantName))
+		}
+		r.Use(ratelimit.Middleware(svc.rateLimits, ipLimit, ratelimit.ByIP))
+		if cfg.AuthMode == config.AuthModeMTLS {
+			r.Use(auth.ClientCertMiddleware(cfg.TLSAllowedClients, withErrorPages))
+		} else {
+			opts := append([]auth.Option{auth.WithOriginCheck(originCheck), withErrorPages}, tokenOpts...)
+			if svc.notifier != nil {
+				opts = append(opts, auth.WithTokenHook(svc.notifier.TokenHook(cfg.TenantName)))
+			}
+			r.Use(auth.TokenMiddleware(tokenManager, opts...))
+			r.Use(ratelimit.Middleware(svc.rateLimits, tokenLimit, ratelimit.ByToken))
+		}
+		if policyEngine != nil {
+			r.Use(auth.PolicyMiddleware(policyEngine, withErrorPages, auth.WithPathPrefix(cfg.RoutePrefix)))
+		}
+		if svc.notifier != nil {
+			r.Use(svc.notifier.Middleware(cfg.TenantName))
+		}
+		docHandler := fileHandler(backend, cfg)
+		r.Get("/*", docHandler)
+		r.Head("/*", docHandler)
+	})
+
+	return r, nil
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/ratelimit"
 	"github.com/pavelanni/cloud-docs/internal/storage"
 )
 
@@ -15,7 +16,7 @@ func TestDirectoryListingPrevention(t *testing.T) {
 	var storageClient *storage.Client
 	cfg := &config.Config{DocsPath: "/docs"}
 	
-	handler := fileHandler(storageClient, cfg.DocsPath)
+	handler := fileHandler(storageClient, cfg)
 
 	// Test directory path with trailing slash
 	req := httptest.NewRequest("GET", "/docs/folder/", nil)
@@ -33,29 +34,69 @@ func TestDirectoryListingPrevention(t *testing.T) {
 }
 
 func TestSecurityHeaders(t *testing.T) {
-	// This test would need a mock storage client that returns a file
-	// For now, we'll test that the headers are set when a file is found
-	t.Skip("Requires mock storage client setup")
-	
-	// Expected headers to test:
+	backend := newMemoryBackend(map[string]memoryObject{
+		"index.html": {content: "<html></html>", contentType: "text/html; charset=utf-8"},
+	})
+	cfg := &config.Config{DocsPath: "/docs", FrameAncestors: []string{"'self'"}}
+
+	handler := fileHandler(backend, cfg)
+
+	req := httptest.NewRequest("GET", "/docs/index.html", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
 	expectedHeaders := map[string]string{
-		"X-Robots-Tag":             "noindex, nofollow, noarchive, nosnippet",
-		"X-Content-Type-Options":   "nosniff",
-		"X-Frame-Options":          "SAMEORIGIN", 
-		"Referrer-Policy":          "no-referrer",
+		"X-Robots-Tag":            "noindex, nofollow, noarchive, nosnippet",
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "frame-ancestors 'self'",
+		"Referrer-Policy":         "no-referrer",
+	}
+
+	for header, expected := range expectedHeaders {
+		if got := w.Header().Get(header); got != expected {
+			t.Errorf("%s = %q, want %q", header, got, expected)
+		}
+	}
+
+	if got := w.Header().Get("X-Frame-Options"); got != "" {
+		t.Errorf("X-Frame-Options should not be set, got %q", got)
 	}
-	
-	// Test HTML file - should have private cache
-	// Test CSS/JS file - should have longer private cache
-	
-	_ = expectedHeaders // Use in actual test implementation
 }
 
 func TestCachePolicyByContentType(t *testing.T) {
-	t.Skip("Requires mock storage client setup")
-	
-	// Test that HTML files get "private, max-age=60"
-	// Test that CSS/JS/images get "private, max-age=3600"
+	backend := newMemoryBackend(map[string]memoryObject{
+		"index.html":     {content: "<html></html>", contentType: "text/html; charset=utf-8"},
+		"css/site.css":   {content: "body{}", contentType: "text/css; charset=utf-8"},
+		"images/map.png": {content: "png", contentType: "image/png"},
+	})
+	cfg := &config.Config{DocsPath: "/docs"}
+
+	handler := fileHandler(backend, cfg)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/docs/index.html", "private, max-age=60"},
+		{"/docs/css/site.css", "private, max-age=3600"},
+		{"/docs/images/map.png", "private, max-age=3600"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if got := w.Header().Get("Cache-Control"); got != tt.expected {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.expected)
+			}
+		})
+	}
 }
 
 func TestStaticRouteNoTokenRequired(t *testing.T) {
@@ -69,4 +110,39 @@ func TestStaticRouteNoTokenRequired(t *testing.T) {
 	// - /docs/index.html -> still requires token
 	
 	t.Skip("Implementation test - static route serves files without authentication")
-}
\ No newline at end of file
+}
+
+func TestSpoofedForwardedForWithDirectTLS(t *testing.T) {
+	cfg := config.Default()
+	cfg.BucketName = "docs"
+	cfg.TLSCertFile, cfg.TLSKeyFile = "cert.pem", "key.pem"
+	cfg.RateLimitIPRate, cfg.RateLimitIPBurst = 0.001, 1
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("Expected trusted_proxy_hops > 0 to be rejected with direct TLS")
+	}
+
+	cfg.TrustedProxyHops = 0
+	svc := &services{
+		buckets: map[string]*bucket{"docs": {backend: newMemoryBackend(map[string]memoryObject{
+			"static/app.css": {content: "body{}", contentType: "text/css"},
+		})}},
+		rateLimits: ratelimit.NewMemoryStore(),
+	}
+	handler, err := newSiteHandler(cfg, svc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A client rotating X-Forwarded-For still shares one per-IP bucket
+	codes := []int{}
+	for _, spoofed := range []string{"198.51.100.1", "198.51.100.2"} {
+		req := httptest.NewRequest("GET", "/docs/static/app.css", nil)
+		req.Header.Set("X-Forwarded-For", spoofed)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("Expected 200 then 429, got %v", codes)
+	}
+}
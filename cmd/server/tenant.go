@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/cache"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/metrics"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// bucket is the backend chain serving one bucket, and its memory cache when
+// enabled. client is what /ready probes.
+type bucket struct {
+	backend     storage.Backend
+	objectCache *cache.MemoryCache
+	client      pinger
+}
+
+// openTenantBuckets opens the buckets named by tenants that the top-level
+// site doesn't use. Each gets the memory cache settings of the main bucket;
+// the disk cache only serves the main bucket. The returned function closes
+// the clients.
+func openTenantBuckets(ctx context.Context, cfg *config.Config, m *metrics.Metrics) (map[string]*bucket, func(), error) {
+	buckets := map[string]*bucket{}
+	var clients []*storage.Client
+	closeAll := func() {
+		for _, client := range clients {
+			client.Close()
+		}
+	}
+
+	for _, t := range cfg.Tenants {
+		name := t.BucketName
+		if name == "" || name == cfg.BucketName || buckets[name] != nil {
+			continue
+		}
+		client, err := storage.NewClient(ctx, name)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		clients = append(clients, client)
+
+		b := &bucket{backend: client, client: client}
+		if m != nil {
+			b.backend = m.InstrumentBackend(client)
+		}
+		if cfg.CacheMaxBytes > 0 {
+			b.objectCache = cache.NewMemoryCache(b.backend, cache.Options{
+				MaxBytes:      cfg.CacheMaxBytes,
+				MaxObjectSize: cfg.CacheMaxObjectSize,
+				TTL:           cfg.CacheTTL,
+				NegativeTTL:   cfg.CacheNegativeTTL,
+			})
+			b.backend = b.objectCache
+			if m != nil {
+				m.RegisterCache("memory:"+name, b.objectCache.Stats)
+			}
+		}
+		buckets[name] = b
+		slog.Info("Connected to tenant bucket", "tenant", t.Name, "bucket", name)
+	}
+	return buckets, closeAll, nil
+}
+
+// prefixBackend serves the objects under prefix, so a tenant can own one
+// folder of a shared bucket.
+type prefixBackend struct {
+	backend storage.Backend
+	prefix  string
+}
+
+func (b *prefixBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	return b.backend.GetFile(ctx, b.prefix+strings.TrimPrefix(objectPath, "/"))
+}
+
+// hidingBackend answers ErrNotFound for objects under prefixes that another
+// site serves from the same bucket.
+type hidingBackend struct {
+	backend  storage.Backend
+	prefixes []string
+}
+
+func (b *hidingBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	name := strings.TrimPrefix(objectPath, "/")
+	for _, prefix := range b.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+		}
+	}
+	return b.backend.GetFile(ctx, objectPath)
+}
+
+// tenantRouter dispatches each request to the site of the tenant matching
+// its Host header, then to the tenant with the longest matching path prefix,
+// and otherwise to the top-level site.
+type tenantRouter struct {
+	hosts    map[string]http.Handler
+	prefixes []prefixRoute
+	fallback http.Handler
+}
+
+type prefixRoute struct {
+	prefix  string
+	handler http.Handler
+}
+
+// newSiteHandler builds the router for cfg and for each of its tenants.
+func newSiteHandler(cfg *config.Config, svc *services, policyEngine *auth.PolicyEngine) (http.Handler, error) {
+	// The top-level site must not serve the folders of tenants in its bucket
+	top := *cfg
+	top.HiddenPrefixes = cfg.NestedPrefixes(cfg.BucketName, cfg.ObjectPrefix)
+	fallback, err := newRouter(&top, svc, policyEngine)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Tenants) == 0 {
+		return fallback, nil
+	}
+
+	tr := &tenantRouter{hosts: map[string]http.Handler{}, fallback: fallback}
+	for _, t := range cfg.Tenants {
+		site, err := newRouter(cfg.Site(t), svc, policyEngine)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		for _, host := range t.Hosts {
+			tr.hosts[strings.ToLower(host)] = site
+		}
+		if t.PathPrefix != "" {
+			tr.prefixes = append(tr.prefixes, prefixRoute{prefix: t.PathPrefix, handler: site})
+		}
+	}
+	sort.Slice(tr.prefixes, func(i, j int) bool {
+		return len(tr.prefixes[i].prefix) > len(tr.prefixes[j].prefix)
+	})
+	return tr, nil
+}
+
+func (tr *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if site, ok := tr.hosts[strings.ToLower(host)]; ok {
+		site.ServeHTTP(w, r)
+		return
+	}
+	for _, route := range tr.prefixes {
+		if r.URL.Path == route.prefix || strings.HasPrefix(r.URL.Path, route.prefix+"/") {
+			route.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	tr.fallback.ServeHTTP(w, r)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/cache"
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/ratelimit"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+func TestTenantRouting(t *testing.T) {
+	cfg := config.Default()
+	cfg.BucketName = "docs"
+	cfg.Tenants = []config.Tenant{
+		{Name: "acme", Hosts: []string{"docs.acme.example"}, ObjectPrefix: "acme/", TokenSecret: "acme-secret",
+			ResponseHeaders: map[string]string{"X-Tenant": "acme"}},
+		{Name: "globex", PathPrefix: "/globex", BucketName: "globex-docs", TokenSecret: "globex-secret"},
+	}
+	svc := &services{
+		buckets: map[string]*bucket{
+			"docs": {backend: newMemoryBackend(map[string]memoryObject{
+				"index.html":      {content: "main", contentType: "text/html"},
+				"acme/index.html": {content: "acme", contentType: "text/html"},
+			})},
+			"globex-docs": {backend: newMemoryBackend(map[string]memoryObject{
+				"index.html": {content: "globex", contentType: "text/html"},
+			})},
+		},
+		rateLimits: ratelimit.NewMemoryStore(),
+	}
+	handler, err := newSiteHandler(cfg, svc, nil)
+	if err != nil {
+		t.Fatalf("newSiteHandler() error = %v", err)
+	}
+
+	mainToken, _ := token.NewManager(cfg.TokenSecret).Generate(time.Hour)
+	acmeToken, _ := token.NewManager("acme-secret").Generate(time.Hour)
+	globexToken, _ := token.NewManager("globex-secret").Generate(time.Hour)
+
+	tests := []struct {
+		name       string
+		host       string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"top-level site", "docs.example.com", "/docs/index.html", mainToken, http.StatusOK, "main"},
+		{"tenant by host", "docs.acme.example", "/docs/index.html", acmeToken, http.StatusOK, "acme"},
+		{"tenant host with port", "DOCS.ACME.EXAMPLE:8443", "/docs/index.html", acmeToken, http.StatusOK, "acme"},
+		{"tenant rejects other secret", "docs.acme.example", "/docs/index.html", mainToken, http.StatusUnauthorized, ""},
+		{"top-level rejects tenant secret", "docs.example.com", "/docs/index.html", acmeToken, http.StatusUnauthorized, ""},
+		{"tenant by path prefix", "docs.example.com", "/globex/docs/index.html", globexToken, http.StatusOK, "globex"},
+		{"path prefix tenant rejects top-level secret", "docs.example.com", "/globex/docs/index.html", mainToken, http.StatusUnauthorized, ""},
+		{"prefix needs a segment boundary", "docs.example.com", "/globexx/docs/index.html", mainToken, http.StatusNotFound, ""},
+		{"top-level hides tenant folder", "whatever.run.app", "/docs/acme/index.html", mainToken, http.StatusNotFound, ""},
+		{"top-level hides tenant folder index", "whatever.run.app", "/docs/acme/", mainToken, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Host = tt.host
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, rr.Body.String())
+			}
+			if rr.Code == http.StatusOK && (rr.Header().Get("X-Tenant") == "acme") != (tt.wantBody == "acme") {
+				t.Errorf("Unexpected X-Tenant header %q", rr.Header().Get("X-Tenant"))
+			}
+		})
+	}
+}
+
+func TestTenantClientCertificates(t *testing.T) {
+	cfg := config.Default()
+	cfg.BucketName = "docs"
+	cfg.AuthMode = config.AuthModeMTLS
+	cfg.TLSAllowedClients = []string{"portal"}
+	cfg.Tenants = []config.Tenant{
+		{Name: "acme", Hosts: []string{"docs.acme.example"}, ObjectPrefix: "acme/", TLSAllowedClients: []string{"acme-portal"}},
+	}
+	svc := &services{
+		buckets: map[string]*bucket{"docs": {backend: newMemoryBackend(map[string]memoryObject{
+			"index.html":      {content: "main", contentType: "text/html"},
+			"acme/index.html": {content: "acme", contentType: "text/html"},
+		})}},
+		rateLimits: ratelimit.NewMemoryStore(),
+	}
+	handler, err := newSiteHandler(cfg, svc, nil)
+	if err != nil {
+		t.Fatalf("newSiteHandler() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		client     string
+		wantStatus int
+	}{
+		{"top-level client", "docs.example.com", "portal", http.StatusOK},
+		{"top-level client on tenant", "docs.acme.example", "portal", http.StatusForbidden},
+		{"tenant client", "docs.acme.example", "acme-portal", http.StatusOK},
+		{"tenant client on top level", "docs.example.com", "acme-portal", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/index.html", nil)
+			req.Host = tt.host
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTenantUnknownBucket(t *testing.T) {
+	cfg := config.Default()
+	cfg.Tenants = []config.Tenant{{Name: "initech", Hosts: []string{"initech.example"}, BucketName: "initech-docs"}}
+	svc := &services{buckets: map[string]*bucket{}, rateLimits: ratelimit.NewMemoryStore()}
+
+	if _, err := newSiteHandler(cfg, svc, nil); err == nil || !strings.Contains(err.Error(), "initech-docs") {
+		t.Errorf("Expected error naming the unopened bucket, got %v", err)
+	}
+}
+
+func TestCachePurgeHandlerObjectPrefix(t *testing.T) {
+	backend := newMemoryBackend(map[string]memoryObject{
+		"acme/index.html":   {content: "acme", contentType: "text/html"},
+		"acme/lab.html":     {content: "lab", contentType: "text/html"},
+		"globex/index.html": {content: "globex", contentType: "text/html"},
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedPurged int
+	}{
+		{"path is relative to the prefix", `{"paths":["/index.html"]}`, 1},
+		{"all stays within the prefix", `{"all":true}`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objectCache := cache.NewMemoryCache(backend, cache.Options{MaxBytes: 1 << 20, MaxObjectSize: 1 << 10, TTL: time.Minute})
+			for name := range backend.objects {
+				fileInfo, err := objectCache.GetFile(context.Background(), name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				io.Copy(io.Discard, fileInfo.Content)
+			}
+
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/admin/cache/purge", bytes.NewBufferString(tt.body))
+			cachePurgeHandler(objectCache, "acme/").ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rr.Code)
+			}
+			if entries := objectCache.Stats().Entries; entries != 3-tt.expectedPurged {
+				t.Errorf("Expected %d entries left, got %d", 3-tt.expectedPurged, entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/webhook"
+)
+
+// newWebhookDispatcher starts delivering to the configured endpoints, or
+// returns nil when none are configured.
+func newWebhookDispatcher(cfg *config.Config) *webhook.Dispatcher {
+	if len(cfg.WebhookURLs) == 0 {
+		return nil
+	}
+	return webhook.NewDispatcher(cfg.WebhookURLs, cfg.WebhookSecret, webhook.Options{
+		Events:      cfg.WebhookEvents,
+		QueueSize:   cfg.WebhookQueueSize,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Timeout:     cfg.WebhookTimeout,
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/config"
+	"github.com/pavelanni/cloud-docs/internal/webhook"
+)
+
+func TestNewWebhookDispatcher(t *testing.T) {
+	tests := []struct {
+		name           string
+		cfg            *config.Config
+		wantDispatcher bool
+	}{
+		{"disabled", &config.Config{}, false},
+		{"configured", &config.Config{WebhookURLs: []string{"https://crm.example.com/hooks"}, WebhookSecret: "s"}, true},
+		{"event filter", &config.Config{WebhookURLs: []string{"https://crm.example.com/hooks"}, WebhookSecret: "s", WebhookEvents: []string{"token.first_used"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newWebhookDispatcher(tt.cfg)
+			if (d != nil) != tt.wantDispatcher {
+				t.Fatalf("newWebhookDispatcher() dispatcher = %v, want dispatcher %v", d, tt.wantDispatcher)
+			}
+			if d != nil {
+				d.Close(context.Background())
+			}
+		})
+	}
+}
+
+func TestWebhookEventsPassValidation(t *testing.T) {
+	cfg := config.Default()
+	cfg.WebhookURLs = []string{"https://crm.example.com/hooks"}
+	cfg.WebhookSecret = "s"
+	cfg.WebhookEvents = webhook.AllEvents
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() rejected a webhook event type: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pavelanni/cloud-docs/internal/config"
@@ -16,6 +17,9 @@ func main() {
 		generate = pflag.BoolP("generate", "g", false, "Generate a new token")
 		validate = pflag.StringP("validate", "v", "", "Validate a token")
 		expires  = pflag.StringP("expires", "e", "24h", "Token expiration duration (e.g., 24h, 168h (1 week), 720h (30 days), 8640h (1 year))")
+		subject  = pflag.StringP("subject", "s", "", "Subject the token is issued to (customer, portal or learner)")
+		roles    = pflag.StringSliceP("role", "r", nil, "Role claim for access policies (repeatable or comma-separated)")
+		origins  = pflag.StringSliceP("origin", "o", nil, "Origin allowed to embed documents with this token, e.g. https://lms.example.com (repeatable)")
 		help     = pflag.BoolP("help", "h", false, "Show help")
 	)
 	pflag.Parse()
@@ -26,6 +30,12 @@ func main() {
 	}
 
 	cfg := config.Load()
+	if err := cfg.ResolveTokenSecret(); err != nil {
+		log.Fatalf("Invalid token secret: %v", err)
+	}
+	if cfg.IsDefaultTokenSecret() {
+		fmt.Fprintln(os.Stderr, "Warning: using the default token secret; these tokens only work with a development server")
+	}
 	tokenManager := token.NewManager(cfg.TokenSecret)
 
 	if *generate {
@@ -34,7 +44,18 @@ func main() {
 			log.Fatalf("Invalid duration: %v", err)
 		}
 
-		tokenString, err := tokenManager.Generate(duration)
+		var opts []token.Option
+		if *subject != "" {
+			opts = append(opts, token.WithSubject(*subject))
+		}
+		if len(*roles) > 0 {
+			opts = append(opts, token.WithRoles(*roles...))
+		}
+		if len(*origins) > 0 {
+			opts = append(opts, token.WithOrigins(*origins...))
+		}
+
+		tokenString, err := tokenManager.Generate(duration, opts...)
 		if err != nil {
 			log.Fatalf("Failed to generate token: %v", err)
 		}
@@ -52,6 +73,15 @@ func main() {
 
 		fmt.Printf("Token is valid:\n")
 		fmt.Printf("  ID: %s\n", validToken.ID)
+		if validToken.Subject != "" {
+			fmt.Printf("  Subject: %s\n", validToken.Subject)
+		}
+		if len(validToken.Roles) > 0 {
+			fmt.Printf("  Roles: %s\n", strings.Join(validToken.Roles, ", "))
+		}
+		if len(validToken.Origins) > 0 {
+			fmt.Printf("  Origins: %s\n", strings.Join(validToken.Origins, ", "))
+		}
 		fmt.Printf("  Issued: %s\n", validToken.IssuedAt.Format(time.RFC3339))
 		fmt.Printf("  Expires: %s\n", validToken.ExpiresAt.Format(time.RFC3339))
 		fmt.Printf("  Time left: %v\n", time.Until(validToken.ExpiresAt).Round(time.Second))
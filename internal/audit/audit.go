@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+// Event records one document access. Token and subject identify the caller
+// without revealing the token itself. Tenant names the site that served the
+// request and is empty for the top-level site.
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Range     string    `json:"range,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// Sink persists audit events. Write must be safe for concurrent use.
+type Sink interface {
+	Write(event Event) error
+	Close() error
+}
+
+type contextKey struct{}
+
+// identity is filled in by the auth middlewares, which run inside Middleware.
+type identity struct {
+	mu      sync.Mutex
+	tokenID string
+	subject string
+}
+
+// SetIdentity records who made the current request. It does nothing outside
+// a request audited by Middleware.
+func SetIdentity(ctx context.Context, tokenID, subject string) {
+	if id, ok := ctx.Value(contextKey{}).(*identity); ok {
+		id.mu.Lock()
+		id.tokenID, id.subject = tokenID, subject
+		id.mu.Unlock()
+	}
+}
+
+// Middleware writes one event per request to sink, including requests
+// rejected by the auth middlewares behind it, labelled with tenant. Only the
+// path is recorded, never the query string. It must run after
+// middleware.RequestID and ratelimit.RealIP.
+func Middleware(sink Sink, tenant string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := &identity{}
+			ctx := context.WithValue(r.Context(), contextKey{}, id)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			id.mu.Lock()
+			event := Event{
+				Time:      start.UTC(),
+				RequestID: middleware.GetReqID(ctx),
+				Tenant:    tenant,
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				Status:    status,
+				Bytes:     ww.BytesWritten(),
+				Range:     r.Header.Get("Range"),
+				TokenID:   id.tokenID,
+				Subject:   id.subject,
+				ClientIP:  clientIP(r.RemoteAddr),
+				UserAgent: r.UserAgent(),
+			}
+			id.mu.Unlock()
+
+			if err := sink.Write(event); err != nil {
+				logging.FromContext(ctx).Error("Failed to write audit event", "path", r.URL.Path, "error", err)
+			}
+		})
+	}
+}
+
+// clientIP strips the port RemoteAddr has when RealIP found no proxy header.
+func clientIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	events []Event
+}
+
+func (s *memorySink) Write(event Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		identify    bool
+		status      int
+		wantTokenID string
+	}{
+		{"authenticated", true, http.StatusOK, "tok-1"},
+		{"rejected", false, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{}
+			handler := Middleware(sink, "acme")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.identify {
+					SetIdentity(r.Context(), "tok-1", "acme-portal")
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte("hello"))
+			}))
+
+			req := httptest.NewRequest("GET", "/docs/guide.html?token=secret", nil)
+			req.RemoteAddr = "203.0.113.7:41234"
+			req.Header.Set("User-Agent", "test-agent")
+			req.Header.Set("Range", "bytes=0-")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if len(sink.events) != 1 {
+				t.Fatalf("Expected 1 event, got %d", len(sink.events))
+			}
+			e := sink.events[0]
+			if e.Path != "/docs/guide.html" || e.Status != tt.status || e.Bytes != 5 {
+				t.Errorf("Unexpected event %+v", e)
+			}
+			if e.Tenant != "acme" {
+				t.Errorf("Expected tenant acme, got %q", e.Tenant)
+			}
+			if e.TokenID != tt.wantTokenID {
+				t.Errorf("Expected token ID %q, got %q", tt.wantTokenID, e.TokenID)
+			}
+			if e.ClientIP != "203.0.113.7" || e.UserAgent != "test-agent" || e.Range != "bytes=0-" {
+				t.Errorf("Unexpected client fields %+v", e)
+			}
+		})
+	}
+}
+
+func TestSetIdentityOutsideRequest(t *testing.T) {
+	// Must not panic without Middleware
+	SetIdentity(context.Background(), "tok-1", "")
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Write(Event{Path: "/docs/a.html", Status: 200}); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events := readEvents(t, mustReadFile(t, path))
+	if len(events) != 2 {
+		t.Errorf("Expected reopened file to be appended to, got %d events", len(events))
+	}
+}
+
+type fakeUploader struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	fail    bool
+}
+
+func (u *fakeUploader) UploadFile(ctx context.Context, objectPath string, content io.Reader, contentType string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.fail {
+		return errors.New("bucket unavailable")
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	u.objects[objectPath] = data
+	return nil
+}
+
+func TestBucketSinkBatchesPerHour(t *testing.T) {
+	uploader := &fakeUploader{objects: map[string][]byte{}}
+	sink := NewBucketSink(uploader, "audit/", time.Hour)
+
+	base := time.Date(2025, 8, 9, 19, 10, 0, 0, time.UTC)
+	sink.Write(Event{Time: base, Path: "/docs/a.html"})
+	sink.Write(Event{Time: base.Add(time.Minute), Path: "/docs/b.html"})
+	sink.Write(Event{Time: base.Add(time.Hour), Path: "/docs/c.html"})
+
+	// The first hour is complete and uploaded on the next flush
+	if err := sink.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	first := "audit/2025/08/09/19/" + sink.instance + "-0.jsonl"
+	if got := readEvents(t, string(uploader.objects[first])); len(got) != 2 {
+		t.Fatalf("Expected 2 events in %s, got %d (objects %v)", first, len(got), keys(uploader.objects))
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	second := "audit/2025/08/09/20/" + sink.instance + "-0.jsonl"
+	if got := readEvents(t, string(uploader.objects[second])); len(got) != 1 || got[0].Path != "/docs/c.html" {
+		t.Errorf("Expected the second hour flushed on Close, got %v", got)
+	}
+}
+
+func TestBucketSinkLateEventsKeepEarlierBatches(t *testing.T) {
+	uploader := &fakeUploader{objects: map[string][]byte{}}
+	sink := NewBucketSink(uploader, "", time.Hour)
+
+	// A long request started before the hour ends after events of the next
+	base := time.Date(2025, 8, 9, 9, 59, 0, 0, time.UTC)
+	for i, offset := range []time.Duration{0, 2 * time.Minute, -time.Minute, 3 * time.Minute} {
+		sink.Write(Event{Time: base.Add(offset), Path: fmt.Sprintf("/docs/%d.html", i)})
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"2025/08/09/09/" + sink.instance + "-0.jsonl",
+		"2025/08/09/09/" + sink.instance + "-1.jsonl",
+		"2025/08/09/10/" + sink.instance + "-0.jsonl",
+		"2025/08/09/10/" + sink.instance + "-1.jsonl",
+	}
+	for _, name := range expected {
+		if got := readEvents(t, string(uploader.objects[name])); len(got) != 1 {
+			t.Errorf("Expected 1 event in %s, got %d (objects %v)", name, len(got), keys(uploader.objects))
+		}
+	}
+}
+
+func TestBucketSinkRetriesFailedUploads(t *testing.T) {
+	uploader := &fakeUploader{objects: map[string][]byte{}, fail: true}
+	sink := NewBucketSink(uploader, "", time.Hour)
+	sink.Write(Event{Time: time.Now(), Path: "/docs/a.html"})
+
+	if err := sink.Close(); err == nil {
+		t.Fatal("Expected upload error")
+	}
+	uploader.fail = false
+	if err := sink.flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploader.objects) != 1 {
+		t.Errorf("Expected the failed batch to be retried, got %v", keys(uploader.objects))
+	}
+}
+
+func readEvents(t *testing.T, data string) []Event {
+	t.Helper()
+	var events []Event
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+func mustReadFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func keys(m map[string][]byte) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
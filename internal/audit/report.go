@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report groupings.
+const (
+	ByToken    = "token"
+	BySubject  = "subject"
+	ByDocument = "document"
+)
+
+// Usage summarizes the views of one token, subject or document.
+type Usage struct {
+	Key string `json:"key"`
+	// Subject is the token's subject when grouping by token.
+	Subject string `json:"subject,omitempty"`
+	// Tenant is the document's site when grouping by document; host-based
+	// tenants serve the same paths.
+	Tenant    string    `json:"tenant,omitempty"`
+	Views     int       `json:"views"`
+	Documents int       `json:"unique_documents"`
+	Tokens    int       `json:"unique_tokens"`
+	Bytes     int64     `json:"bytes"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+
+	documents map[string]struct{}
+	tokens    map[string]struct{}
+}
+
+// Report aggregates audit events into usage rows.
+type Report struct {
+	groupBy string
+	since   time.Time
+	until   time.Time
+	rows    map[string]*Usage
+}
+
+// NewReport groups by ByToken, BySubject or ByDocument. Events outside
+// [since, until) are ignored; zero times leave that end open.
+func NewReport(groupBy string, since, until time.Time) (*Report, error) {
+	switch groupBy {
+	case ByToken, BySubject, ByDocument:
+	default:
+		return nil, fmt.Errorf("invalid grouping %q: expected token, subject or document", groupBy)
+	}
+	return &Report{groupBy: groupBy, since: since, until: until, rows: map[string]*Usage{}}, nil
+}
+
+// Add counts a GET served to an identified caller: bytes and times for
+// every one, and a view when IsView. Rejected requests and HEAD probes are
+// ignored.
+func (rep *Report) Add(event Event) {
+	if event.Method != "GET" || !served(event.Status) {
+		return
+	}
+	if event.TokenID == "" && event.Subject == "" {
+		return
+	}
+	if !rep.since.IsZero() && event.Time.Before(rep.since) {
+		return
+	}
+	if !rep.until.IsZero() && !event.Time.Before(rep.until) {
+		return
+	}
+
+	var key string
+	switch rep.groupBy {
+	case ByToken:
+		key = event.TokenID
+	case BySubject:
+		key = event.Subject
+	case ByDocument:
+		key = event.Path
+	}
+	if key == "" {
+		return
+	}
+
+	rowKey := key
+	if rep.groupBy == ByDocument {
+		rowKey = documentKey(event)
+	}
+	row, ok := rep.rows[rowKey]
+	if !ok {
+		row = &Usage{Key: key, FirstSeen: event.Time, LastSeen: event.Time,
+			documents: map[string]struct{}{}, tokens: map[string]struct{}{}}
+		if rep.groupBy == ByDocument {
+			row.Tenant = event.Tenant
+		}
+		rep.rows[rowKey] = row
+	}
+	if IsView(event.Method, event.Status, event.Range) {
+		row.Views++
+	}
+	row.Bytes += int64(event.Bytes)
+	if event.Time.Before(row.FirstSeen) {
+		row.FirstSeen = event.Time
+	}
+	if event.Time.After(row.LastSeen) {
+		row.LastSeen = event.Time
+	}
+	if rep.groupBy == ByToken && event.Subject != "" {
+		row.Subject = event.Subject
+	}
+	row.documents[documentKey(event)] = struct{}{}
+	row.Documents = len(row.documents)
+	if event.TokenID != "" {
+		row.tokens[event.TokenID] = struct{}{}
+		row.Tokens = len(row.tokens)
+	}
+}
+
+// documentKey tells apart the same path served by different tenants.
+func documentKey(event Event) string {
+	return event.Tenant + "\x00" + event.Path
+}
+
+func served(status int) bool {
+	return status == 200 || status == 206 || status == 304
+}
+
+// IsView reports whether a response opens a document: a GET answered with
+// 200, or with 206 for a range from the first byte, as PDF viewers and video
+// players request on open. Their later ranges and 304 revalidations are not
+// views.
+func IsView(method string, status int, rangeHeader string) bool {
+	if method != "GET" {
+		return false
+	}
+	switch status {
+	case 200:
+		return true
+	case 206:
+		spec, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(rangeHeader), "bytes="), ",")
+		return strings.HasPrefix(strings.TrimSpace(spec), "0-")
+	}
+	return false
+}
+
+// Rows returns the usage rows, most viewed first.
+func (rep *Report) Rows() []Usage {
+	rows := make([]Usage, 0, len(rep.rows))
+	for _, row := range rep.rows {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Views != rows[j].Views {
+			return rows[i].Views > rows[j].Views
+		}
+		if rows[i].Key != rows[j].Key {
+			return rows[i].Key < rows[j].Key
+		}
+		return rows[i].Tenant < rows[j].Tenant
+	})
+	return rows
+}
+
+// ReadEvents decodes JSON-lines audit data, as written by the sinks, and
+// calls fn for each event.
+func ReadEvents(r io.Reader, fn func(Event)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("line %d: invalid audit event: %w", line, err)
+		}
+		fn(event)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	base := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: base, Method: "GET", Path: "/docs/a.html", Status: 200, Bytes: 100, TokenID: "t1", Subject: "acme"},
+		{Time: base.Add(time.Hour), Method: "GET", Path: "/docs/b.html", Status: 200, Bytes: 50, TokenID: "t1", Subject: "acme"},
+		{Time: base.Add(2 * time.Hour), Method: "GET", Path: "/docs/a.html", Status: 304, TokenID: "t1", Subject: "acme"},
+		{Time: base.Add(30 * time.Minute), Method: "GET", Path: "/docs/a.html", Status: 206, Bytes: 10, Range: "bytes=0-1023", TokenID: "t2", Subject: "acme"},
+		// The same path on another tenant's site is another document
+		{Time: base.Add(3 * time.Hour), Tenant: "globex", Method: "GET", Path: "/docs/b.html", Status: 200, Bytes: 40, TokenID: "t3", Subject: "globex"},
+		// Served but not views
+		{Time: base.Add(31 * time.Minute), Method: "GET", Path: "/docs/a.html", Status: 206, Bytes: 20, Range: "bytes=1024-", TokenID: "t2", Subject: "acme"},
+		// Ignored
+		{Time: base, Method: "GET", Path: "/docs/a.html", Status: 401},
+		{Time: base, Method: "HEAD", Path: "/docs/a.html", Status: 200, TokenID: "t2"},
+		{Time: base, Method: "GET", Path: "/docs/c.html", Status: 404, TokenID: "t2"},
+	}
+
+	tests := []struct {
+		by   string
+		want []Usage
+	}{
+		{ByToken, []Usage{
+			{Key: "t1", Subject: "acme", Views: 2, Documents: 2, Tokens: 1, Bytes: 150, FirstSeen: base, LastSeen: base.Add(2 * time.Hour)},
+			{Key: "t2", Subject: "acme", Views: 1, Documents: 1, Tokens: 1, Bytes: 30, FirstSeen: base.Add(30 * time.Minute), LastSeen: base.Add(31 * time.Minute)},
+			{Key: "t3", Subject: "globex", Views: 1, Documents: 1, Tokens: 1, Bytes: 40, FirstSeen: base.Add(3 * time.Hour), LastSeen: base.Add(3 * time.Hour)},
+		}},
+		{BySubject, []Usage{
+			{Key: "acme", Views: 3, Documents: 2, Tokens: 2, Bytes: 180, FirstSeen: base, LastSeen: base.Add(2 * time.Hour)},
+			{Key: "globex", Views: 1, Documents: 1, Tokens: 1, Bytes: 40, FirstSeen: base.Add(3 * time.Hour), LastSeen: base.Add(3 * time.Hour)},
+		}},
+		{ByDocument, []Usage{
+			{Key: "/docs/a.html", Views: 2, Documents: 1, Tokens: 2, Bytes: 130, FirstSeen: base, LastSeen: base.Add(2 * time.Hour)},
+			{Key: "/docs/b.html", Views: 1, Documents: 1, Tokens: 1, Bytes: 50, FirstSeen: base.Add(time.Hour), LastSeen: base.Add(time.Hour)},
+			{Key: "/docs/b.html", Tenant: "globex", Views: 1, Documents: 1, Tokens: 1, Bytes: 40, FirstSeen: base.Add(3 * time.Hour), LastSeen: base.Add(3 * time.Hour)},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			report, err := NewReport(tt.by, time.Time{}, time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range events {
+				report.Add(e)
+			}
+
+			rows := report.Rows()
+			if len(rows) != len(tt.want) {
+				t.Fatalf("Expected %d rows, got %+v", len(tt.want), rows)
+			}
+			for i, want := range tt.want {
+				got := rows[i]
+				got.documents, got.tokens = nil, nil
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Row %d:\n got %+v\nwant %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsView(t *testing.T) {
+	tests := []struct {
+		method      string
+		status      int
+		rangeHeader string
+		want        bool
+	}{
+		{"GET", 200, "", true},
+		{"GET", 206, "bytes=0-", true},
+		{"GET", 206, "bytes=0-1023, 4096-8191", true},
+		{"GET", 206, "bytes=1024-2047", false},
+		{"GET", 206, "bytes=-500", false},
+		{"GET", 206, "", false},
+		{"GET", 304, "", false},
+		{"HEAD", 200, "", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsView(tt.method, tt.status, tt.rangeHeader); got != tt.want {
+			t.Errorf("IsView(%s, %d, %q) = %v, want %v", tt.method, tt.status, tt.rangeHeader, got, tt.want)
+		}
+	}
+}
+
+func TestReportTimeRange(t *testing.T) {
+	base := time.Date(2025, 8, 9, 10, 0, 0, 0, time.UTC)
+	report, _ := NewReport(ByToken, base, base.Add(time.Hour))
+	for _, offset := range []time.Duration{-time.Minute, 0, 59 * time.Minute, time.Hour} {
+		report.Add(Event{Time: base.Add(offset), Method: "GET", Path: "/docs/a.html", Status: 200, TokenID: "t1"})
+	}
+
+	rows := report.Rows()
+	if len(rows) != 1 || rows[0].Views != 2 {
+		t.Errorf("Expected 2 views within [since, until), got %+v", rows)
+	}
+}
+
+func TestNewReportInvalidGrouping(t *testing.T) {
+	if _, err := NewReport("ip", time.Time{}, time.Time{}); err == nil {
+		t.Error("Expected error for unknown grouping")
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	input := `{"time":"2025-08-09T10:00:00Z","method":"GET","path":"/docs/a.html","status":200}
+
+{"time":"2025-08-09T10:01:00Z","method":"GET","path":"/docs/b.html","status":200}
+`
+	var paths []string
+	if err := ReadEvents(strings.NewReader(input), func(e Event) { paths = append(paths, e.Path) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[1] != "/docs/b.html" {
+		t.Errorf("Unexpected events %v", paths)
+	}
+
+	err := ReadEvents(strings.NewReader("{\"path\":\"/docs/a.html\"}\nnot json\n"), func(Event) {})
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSink writes events as JSON lines, e.g. to stdout or a file.
+type WriterSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, enc: json.NewEncoder(w)}
+}
+
+// NewFileSink appends events to a JSON-lines file, creating it if needed.
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return NewWriterSink(f), nil
+}
+
+func (s *WriterSink) Write(event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// Close closes the underlying writer unless it is stdout or stderr.
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == os.Stdout || s.w == os.Stderr {
+		return nil
+	}
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Uploader stores an object; storage.Client implements it.
+type Uploader interface {
+	UploadFile(ctx context.Context, objectPath string, content io.Reader, contentType string) error
+}
+
+// maxBatchBytes starts a new object before the hour is over, so a busy hour
+// doesn't pile up in memory.
+const maxBatchBytes = 8 << 20
+
+// BucketSink buffers events and uploads them as one JSON-lines object per
+// hour, named <prefix>YYYY/MM/DD/HH/<instance>-<part>.jsonl. Events are
+// filed under the hour their request started, so a late event reopens an
+// earlier hour with its next part number. Objects are immutable once
+// written; events still buffered when the process dies are lost, so Close
+// must be called on shutdown.
+type BucketSink struct {
+	uploader Uploader
+	prefix   string
+	instance string
+
+	mu      sync.Mutex
+	hour    time.Time
+	parts   map[time.Time]int // next part number of each recent hour
+	buf     bytes.Buffer
+	pending []batch
+
+	flushMu sync.Mutex
+	now     func() time.Time
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+type batch struct {
+	objectPath string
+	data       []byte
+}
+
+// NewBucketSink starts a sink that checks every interval whether the hour
+// has ended and uploads completed batches.
+func NewBucketSink(uploader Uploader, prefix string, interval time.Duration) *BucketSink {
+	s := &BucketSink{
+		uploader: uploader,
+		prefix:   prefix,
+		instance: instanceID(),
+		parts:    make(map[time.Time]int),
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// instanceID tells apart objects written by concurrent server instances.
+func instanceID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *BucketSink) Write(event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hour := event.Time.UTC().Truncate(time.Hour)
+	if s.buf.Len() > 0 && !hour.Equal(s.hour) {
+		s.cutLocked()
+	}
+	s.hour = hour
+	s.buf.Write(line)
+	s.buf.WriteByte('\n')
+	if s.buf.Len() >= maxBatchBytes {
+		s.cutLocked()
+	}
+	return nil
+}
+
+// cutLocked moves the buffered events into a pending batch. Part numbers
+// are kept for a day, longer than any request whose event could still
+// arrive.
+func (s *BucketSink) cutLocked() {
+	part := s.parts[s.hour]
+	name := fmt.Sprintf("%s%s/%s-%d.jsonl", s.prefix, s.hour.Format("2006/01/02/15"), s.instance, part)
+	s.pending = append(s.pending, batch{objectPath: name, data: bytes.Clone(s.buf.Bytes())})
+	s.buf.Reset()
+	s.parts[s.hour] = part + 1
+
+	for hour := range s.parts {
+		if s.hour.Sub(hour) > 24*time.Hour {
+			delete(s.parts, hour)
+		}
+	}
+}
+
+func (s *BucketSink) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.buf.Len() > 0 && s.now().UTC().Truncate(time.Hour).After(s.hour) {
+				s.cutLocked()
+			}
+			s.mu.Unlock()
+			if err := s.flush(context.Background()); err != nil {
+				slog.Error("Failed to upload audit events", "error", err)
+			}
+		}
+	}
+}
+
+// flush uploads pending batches; failed batches stay queued for the next try.
+func (s *BucketSink) flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	batches := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for i, b := range batches {
+		if err := s.uploader.UploadFile(ctx, b.objectPath, bytes.NewReader(b.data), "application/x-ndjson"); err != nil {
+			s.mu.Lock()
+			s.pending = append(batches[i:], s.pending...)
+			s.mu.Unlock()
+			return fmt.Errorf("failed to upload %s: %w", b.objectPath, err)
+		}
+	}
+	return nil
+}
+
+// Close uploads everything still buffered.
+func (s *BucketSink) Close() error {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	if s.buf.Len() > 0 {
+		s.cutLocked()
+	}
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.flush(ctx)
+}
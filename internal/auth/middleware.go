@@ -2,40 +2,197 @@ package auth
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strings"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/logging"
 	"github.com/pavelanni/cloud-docs/pkg/token"
 )
 
+const tracerName = "github.com/pavelanni/cloud-docs/internal/auth"
+
 type contextKey string
 
 const TokenContextKey contextKey = "token"
 
-func TokenMiddleware(tokenManager *token.Manager) func(http.Handler) http.Handler {
+// Option configures the auth middlewares.
+type Option func(*options)
+
+// ErrorHandler writes an error response for a rejected request.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, message string)
+
+// TokenHook is called after every token validation. t is set for valid and
+// expired tokens and nil otherwise.
+type TokenHook func(r *http.Request, outcome string, t *token.Token)
+
+type options struct {
+	originCheck   OriginCheckMode
+	errorHandler  ErrorHandler
+	tokenObserver func(outcome string)
+	tokenHook     TokenHook
+	pathPrefix    string
+}
+
+// Token validation outcomes reported to WithTokenObserver.
+const (
+	TokenValid        = "valid"
+	TokenMissing      = "missing"
+	TokenExpired      = "expired"
+	TokenBadSignature = "bad_signature"
+	TokenMalformed    = "malformed"
+)
+
+func newOptions(opts []Option) options {
+	o := options{
+		originCheck: OriginCheckOff,
+		errorHandler: func(w http.ResponseWriter, r *http.Request, status int, message string) {
+			http.Error(w, message, status)
+		},
+		tokenObserver: func(string) {},
+		tokenHook:     func(*http.Request, string, *token.Token) {},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithOriginCheck checks the request origin against the token's origins claim.
+// OriginCheckLog only reports mismatches; OriginCheckEnforce rejects them.
+func WithOriginCheck(mode OriginCheckMode) Option {
+	return func(o *options) {
+		o.originCheck = mode
+	}
+}
+
+// WithErrorHandler replaces the plain-text http.Error responses, e.g. with
+// branded error pages.
+func WithErrorHandler(handler ErrorHandler) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+// WithTokenObserver reports the outcome of every token validation, e.g. to
+// count them in metrics.
+func WithTokenObserver(observe func(outcome string)) Option {
+	return func(o *options) {
+		o.tokenObserver = observe
+	}
+}
+
+// WithTokenHook passes each validation outcome, with the request and token
+// claims, to hook, e.g. to send webhook notifications. The hook runs on the
+// request path and must not block.
+func WithTokenHook(hook TokenHook) Option {
+	return func(o *options) {
+		o.tokenHook = hook
+	}
+}
+
+// WithPathPrefix removes prefix, e.g. a tenant's path prefix, from request
+// paths before PolicyMiddleware matches them, so policy paths are the same
+// for every site.
+func WithPathPrefix(prefix string) Option {
+	return func(o *options) {
+		o.pathPrefix = prefix
+	}
+}
+
+func TokenMiddleware(tokenManager *token.Manager, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	tracer := otel.Tracer(tracerName)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The span carries the outcome and token ID, never the token itself
+			_, span := tracer.Start(r.Context(), "auth.ValidateToken")
 			tokenString := extractToken(r)
 			if tokenString == "" {
-				http.Error(w, "Access token required", http.StatusUnauthorized)
+				span.SetAttributes(attribute.String("auth.outcome", TokenMissing))
+				span.End()
+				o.tokenObserver(TokenMissing)
+				o.tokenHook(r, TokenMissing, nil)
+				o.errorHandler(w, r, http.StatusUnauthorized, "Access token required")
 				return
 			}
 
 			validToken, err := tokenManager.Validate(tokenString)
+			span.SetAttributes(attribute.String("auth.outcome", tokenOutcome(err)))
+			if err == nil {
+				span.SetAttributes(attribute.String("auth.token_id", validToken.ID))
+			}
+			span.End()
+			o.tokenObserver(tokenOutcome(err))
+			hookToken := validToken
+			var expired *token.ExpiredError
+			if errors.As(err, &expired) {
+				hookToken = expired.Token
+			}
+			o.tokenHook(r, tokenOutcome(err), hookToken)
 			if err != nil {
 				// Don't log token details to avoid exposing tokens in Cloud Run logs
-				log.Printf("Token validation failed for request to %s", r.URL.Path)
-				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				logging.FromContext(r.Context()).Info("Token validation failed", "path", r.URL.Path)
+				o.errorHandler(w, r, http.StatusUnauthorized, "Invalid or expired token")
 				return
 			}
 
+			// The ID identifies the token without revealing it
+			logging.AddAttrs(r.Context(), slog.String("token_id", validToken.ID))
+			audit.SetIdentity(r.Context(), validToken.ID, validToken.Subject)
+
+			if o.originCheck != OriginCheckOff && len(validToken.Origins) > 0 {
+				if ok, reason := checkRequestOrigin(r, validToken.Origins); !ok {
+					logging.FromContext(r.Context()).Warn("Token origin check failed", "path", r.URL.Path, "reason", reason)
+					if o.originCheck == OriginCheckEnforce {
+						o.errorHandler(w, r, http.StatusForbidden, "Token not valid from this site")
+						return
+					}
+				}
+			}
+
 			ctx := context.WithValue(r.Context(), TokenContextKey, validToken)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// RequireRole rejects requests whose token doesn't carry role. It must run
+// after TokenMiddleware.
+func RequireRole(role string, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t := GetTokenFromContext(r.Context())
+			if t == nil || !contains(t.Roles, role) {
+				logging.FromContext(r.Context()).Warn("Request denied: role required", "path", r.URL.Path, "role", role)
+				o.errorHandler(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func tokenOutcome(err error) string {
+	switch {
+	case err == nil:
+		return TokenValid
+	case errors.Is(err, token.ErrExpired):
+		return TokenExpired
+	case errors.Is(err, token.ErrBadSignature):
+		return TokenBadSignature
+	default:
+		return TokenMalformed
+	}
+}
+
 func extractToken(r *http.Request) string {
 	tokenString := r.URL.Query().Get("token")
 	if tokenString != "" {
@@ -6,6 +6,12 @@ import (
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
 	"github.com/pavelanni/cloud-docs/pkg/token"
 )
 
@@ -163,4 +169,164 @@ func TestExtractToken(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestRequireRole(t *testing.T) {
+	tokenManager := token.NewManager("test-secret")
+	handler := TokenMiddleware(tokenManager)(RequireRole("admin")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	tests := []struct {
+		name           string
+		roles          []string
+		expectedStatus int
+	}{
+		{"admin", []string{"admin"}, http.StatusOK},
+		{"admin among others", []string{"editor", "admin"}, http.StatusOK},
+		{"other role", []string{"editor"}, http.StatusForbidden},
+		{"no roles", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenString, err := tokenManager.Generate(time.Hour, token.WithRoles(tt.roles...))
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/admin/cache/purge", nil)
+			req.Header.Set("Authorization", "Bearer "+tokenString)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestTokenMiddlewareErrorHandler(t *testing.T) {
+	var gotStatus int
+	var gotMessage string
+	errorHandler := func(w http.ResponseWriter, r *http.Request, status int, message string) {
+		gotStatus, gotMessage = status, message
+		w.WriteHeader(status)
+	}
+
+	middleware := TokenMiddleware(token.NewManager("test-secret"), WithErrorHandler(errorHandler))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler should not be called")
+	}))
+
+	req := httptest.NewRequest("GET", "/docs/test.html?token=invalid", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if gotStatus != http.StatusUnauthorized || gotMessage != "Invalid or expired token" {
+		t.Errorf("Error handler got (%d, %q)", gotStatus, gotMessage)
+	}
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", rr.Code)
+	}
+}
+
+func TestTokenMiddlewareObserver(t *testing.T) {
+	tokenManager := token.NewManager("test-secret")
+	validToken, _ := tokenManager.Generate(time.Hour)
+	expiredToken, _ := tokenManager.Generate(-time.Hour)
+	foreignToken, _ := token.NewManager("other-secret").Generate(time.Hour)
+
+	var outcome string
+	handler := TokenMiddleware(tokenManager, WithTokenObserver(func(o string) { outcome = o }))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		token string
+		want  string
+	}{
+		{validToken, TokenValid},
+		{"", TokenMissing},
+		{expiredToken, TokenExpired},
+		{foreignToken, TokenBadSignature},
+		{"not-a-token", TokenMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			outcome = ""
+			req := httptest.NewRequest("GET", "/docs/test.html", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if outcome != tt.want {
+				t.Errorf("Expected outcome %q, got %q", tt.want, outcome)
+			}
+		})
+	}
+}
+
+func TestTokenMiddlewareSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	tokenManager := token.NewManager("test-secret")
+	validToken, _ := tokenManager.Generate(time.Hour)
+	handler := TokenMiddleware(tokenManager)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/docs/test.html?token="+validToken, nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "auth.ValidateToken" {
+		t.Fatalf("Expected one auth.ValidateToken span, got %v", spans)
+	}
+	attrs := map[attribute.Key]string{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+		if kv.Value.Emit() == validToken {
+			t.Errorf("Span attribute %s contains the token", kv.Key)
+		}
+	}
+	if attrs["auth.outcome"] != TokenValid {
+		t.Errorf("Expected outcome %q, got %q", TokenValid, attrs["auth.outcome"])
+	}
+	if attrs["auth.token_id"] == "" {
+		t.Error("Expected token ID attribute")
+	}
+}
+
+type recordingSink struct {
+	events []audit.Event
+}
+
+func (s *recordingSink) Write(event audit.Event) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) Close() error { return nil }
+
+func TestTokenMiddlewareAuditIdentity(t *testing.T) {
+	tokenManager := token.NewManager("test-secret")
+	validToken, _ := tokenManager.Generate(time.Hour, token.WithSubject("acme-portal"))
+	parsed, _ := tokenManager.Validate(validToken)
+
+	sink := &recordingSink{}
+	handler := audit.Middleware(sink, "")(TokenMiddleware(tokenManager)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	req := httptest.NewRequest("GET", "/docs/test.html", nil)
+	req.Header.Set("Authorization", "Bearer "+validToken)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("Expected 1 audit event, got %d", len(sink.events))
+	}
+	if e := sink.events[0]; e.TokenID != parsed.ID || e.Subject != "acme-portal" {
+		t.Errorf("Expected token %s and subject acme-portal, got %+v", parsed.ID, e)
+	}
+}
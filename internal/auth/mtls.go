@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+const ClientIdentityContextKey contextKey = "client_identity"
+
+// ClientIdentity describes the verified certificate a client presented on a
+// mutually authenticated TLS connection.
+type ClientIdentity struct {
+	Subject        string
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+}
+
+// ClientCertMiddleware authorizes requests by the client certificate verified
+// during the TLS handshake. Each allow-list entry is compared against the
+// certificate subject DN (e.g. "CN=portal,O=Acme"), its common name, and every
+// DNS, email and URI subject alternative name.
+func ClientCertMiddleware(allowed []string, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	allowSet := make(map[string]struct{}, len(allowed))
+	for _, entry := range allowed {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			allowSet[entry] = struct{}{}
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := verifiedClientCert(r)
+			if cert == nil {
+				o.errorHandler(w, r, http.StatusUnauthorized, "Client certificate required")
+				return
+			}
+
+			identity := newClientIdentity(cert)
+			if !identity.matches(allowSet) {
+				logging.FromContext(r.Context()).Warn("Client certificate not allowed", "path", r.URL.Path, "subject", identity.Subject)
+				o.errorHandler(w, r, http.StatusForbidden, "Client certificate not authorized")
+				return
+			}
+
+			logging.AddAttrs(r.Context(), slog.String("client_subject", identity.Subject))
+			audit.SetIdentity(r.Context(), "", identity.Subject)
+
+			ctx := context.WithValue(r.Context(), ClientIdentityContextKey, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// verifiedClientCert returns the leaf of the first verified chain. Certificates
+// that were presented but not verified against the client CA are ignored.
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+func newClientIdentity(cert *x509.Certificate) *ClientIdentity {
+	identity := &ClientIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+	}
+	for _, uri := range cert.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+	}
+	return identity
+}
+
+func (id *ClientIdentity) names() []string {
+	names := []string{id.Subject}
+	if id.CommonName != "" {
+		names = append(names, id.CommonName)
+	}
+	names = append(names, id.DNSNames...)
+	names = append(names, id.EmailAddresses...)
+	return append(names, id.URIs...)
+}
+
+func (id *ClientIdentity) matches(allowSet map[string]struct{}) bool {
+	for _, name := range id.names() {
+		if _, ok := allowSet[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func GetClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	if identity, ok := ctx.Value(ClientIdentityContextKey).(*ClientIdentity); ok {
+		return identity
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClientCert(t *testing.T, commonName string, dnsNames ...string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Acme"}},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	portalCert := newTestClientCert(t, "portal", "portal.acme.example")
+	otherCert := newTestClientCert(t, "intruder", "intruder.example")
+
+	middleware := ClientCertMiddleware([]string{"portal.acme.example", "CN=reports,O=Acme"})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := GetClientIdentityFromContext(r.Context())
+		if identity == nil {
+			t.Error("Expected client identity in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		tls            *tls.ConnectionState
+		expectedStatus int
+	}{
+		{
+			name:           "plain HTTP",
+			tls:            nil,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "TLS without client certificate",
+			tls:            &tls.ConnectionState{},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unverified client certificate",
+			tls:            &tls.ConnectionState{PeerCertificates: []*x509.Certificate{portalCert}},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "allowed by DNS SAN",
+			tls:            &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{portalCert}}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed by subject DN",
+			tls:            &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{newTestClientCert(t, "reports")}}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "not in allow-list",
+			tls:            &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{otherCert}}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.TLS = tt.tls
+
+			rr := httptest.NewRecorder()
+			middleware(handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestClientIdentityFromCertificate(t *testing.T) {
+	cert := newTestClientCert(t, "portal", "portal.acme.example")
+
+	identity := newClientIdentity(cert)
+	if identity.CommonName != "portal" {
+		t.Errorf("Expected common name %q, got %q", "portal", identity.CommonName)
+	}
+	if identity.Subject != "CN=portal,O=Acme" {
+		t.Errorf("Expected subject %q, got %q", "CN=portal,O=Acme", identity.Subject)
+	}
+	if len(identity.DNSNames) != 1 || identity.DNSNames[0] != "portal.acme.example" {
+		t.Errorf("Unexpected DNS names: %v", identity.DNSNames)
+	}
+}
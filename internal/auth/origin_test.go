@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+func TestCheckRequestOrigin(t *testing.T) {
+	allowed := []string{"https://lms.example.com", "https://*.academy.example"}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{"no browser signals", nil, true},
+		{"same-origin fetch", map[string]string{"Sec-Fetch-Site": "same-origin"}, true},
+		{"allowed origin header", map[string]string{"Origin": "https://lms.example.com"}, true},
+		{"other origin header", map[string]string{"Origin": "https://evil.example"}, false},
+		{"allowed referer", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://lms.example.com/course/42"}, true},
+		{"wildcard referer", map[string]string{"Referer": "https://eu.academy.example/lesson"}, true},
+		{"wildcard does not match parent", map[string]string{"Referer": "https://academy.example/lesson"}, false},
+		{"wrong scheme", map[string]string{"Referer": "http://lms.example.com/course"}, false},
+		{"referer from this server", map[string]string{"Referer": "http://example.com/docs/index.html"}, true},
+		{"other referer", map[string]string{"Sec-Fetch-Site": "cross-site", "Referer": "https://forum.example/thread"}, false},
+		{"direct navigation", map[string]string{"Sec-Fetch-Site": "none"}, false},
+		{"cross-site without referer", map[string]string{"Sec-Fetch-Site": "cross-site"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/docs/index.html", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+
+			ok, reason := checkRequestOrigin(req, allowed)
+			if ok != tt.expected {
+				t.Errorf("checkRequestOrigin() = %v (%s), want %v", ok, reason, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTokenMiddlewareOriginCheck(t *testing.T) {
+	tokenManager := token.NewManager("test-secret")
+
+	boundToken, err := tokenManager.Generate(time.Hour, token.WithOrigins("https://lms.example.com"))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+	unboundToken, err := tokenManager.Generate(time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		mode           OriginCheckMode
+		token          string
+		referer        string
+		expectedStatus int
+	}{
+		{"enforce allows embedding page", OriginCheckEnforce, boundToken, "https://lms.example.com/course", http.StatusOK},
+		{"enforce rejects shared link", OriginCheckEnforce, boundToken, "https://forum.example/thread", http.StatusForbidden},
+		{"log mode only reports", OriginCheckLog, boundToken, "https://forum.example/thread", http.StatusOK},
+		{"off ignores origins", OriginCheckOff, boundToken, "https://forum.example/thread", http.StatusOK},
+		{"tokens without origins are unbound", OriginCheckEnforce, unboundToken, "https://forum.example/thread", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/index.html", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			req.Header.Set("Referer", tt.referer)
+
+			rr := httptest.NewRecorder()
+			TokenMiddleware(tokenManager, WithOriginCheck(tt.mode))(handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseOriginCheckMode(t *testing.T) {
+	for _, s := range []string{"off", "log", "ENFORCE"} {
+		if _, err := ParseOriginCheckMode(s); err != nil {
+			t.Errorf("ParseOriginCheckMode(%q) unexpected error: %v", s, err)
+		}
+	}
+	if _, err := ParseOriginCheckMode("strict"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
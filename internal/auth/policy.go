@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Rule grants or denies access to requests matching all of its conditions.
+// Empty Paths or Methods match everything; every attribute listed in When must
+// have at least one of the given values on the request identity.
+type Rule struct {
+	Name    string              `yaml:"name" json:"name"`
+	Effect  string              `yaml:"effect" json:"effect"`
+	Paths   []string            `yaml:"paths" json:"paths"`
+	Methods []string            `yaml:"methods" json:"methods"`
+	When    map[string][]string `yaml:"when" json:"when"`
+}
+
+// Policy is an ordered list of rules. The first matching rule decides;
+// requests that match no rule get the Default effect.
+type Policy struct {
+	Default string `yaml:"default" json:"default"`
+	Rules   []Rule `yaml:"rules" json:"rules"`
+}
+
+// Attributes describe the authenticated identity behind a request, keyed by
+// attribute name (for example "role" or "sub").
+type Attributes map[string][]string
+
+// ParsePolicy decodes a YAML or JSON policy document and validates it.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+
+	if policy.Default == "" {
+		policy.Default = EffectDeny
+	}
+	if policy.Default != EffectAllow && policy.Default != EffectDeny {
+		return nil, fmt.Errorf("invalid default effect %q", policy.Default)
+	}
+
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return nil, fmt.Errorf("%s: invalid effect %q", rule.Name, rule.Effect)
+		}
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%s: invalid path pattern %q", rule.Name, pattern)
+			}
+		}
+		for j, method := range rule.Methods {
+			rule.Methods[j] = strings.ToUpper(method)
+		}
+	}
+
+	return &policy, nil
+}
+
+// Evaluate reports whether the request is allowed and the name of the rule
+// that decided it ("default" when no rule matched).
+func (p *Policy) Evaluate(method, requestPath string, attrs Attributes) (bool, string) {
+	requestPath = cleanRequestPath(requestPath)
+	for _, rule := range p.Rules {
+		if rule.matches(method, requestPath, attrs) {
+			return rule.Effect == EffectAllow, rule.Name
+		}
+	}
+	return p.Default == EffectAllow, "default"
+}
+
+func (rule *Rule) matches(method, requestPath string, attrs Attributes) bool {
+	if len(rule.Methods) > 0 && !contains(rule.Methods, method) {
+		return false
+	}
+
+	if len(rule.Paths) > 0 {
+		matched := false
+		for _, pattern := range rule.Paths {
+			if matchPath(pattern, requestPath) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	for name, values := range rule.When {
+		if !containsAny(attrs[name], values) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPath matches a slash-separated glob where "**" spans any number of
+// segments and other segments use path.Match syntax.
+func matchPath(pattern, requestPath string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(requestPath, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(segments); i >= 0; i-- {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// cleanRequestPath resolves dot segments so "/docs/public/../partners/x"
+// cannot slip past a rule written for "/docs/partners/**".
+func cleanRequestPath(requestPath string) string {
+	cleaned := path.Clean("/" + requestPath)
+	if strings.HasSuffix(requestPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(have, want []string) bool {
+	for _, value := range want {
+		if contains(have, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyEngine holds the active policy loaded from a file and swaps it
+// atomically when the file changes.
+type PolicyEngine struct {
+	path   string
+	policy atomic.Pointer[Policy]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewPolicyEngine loads the policy at path. The initial load must succeed.
+func NewPolicyEngine(path string) (*PolicyEngine, error) {
+	engine := &PolicyEngine{path: path}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// Policy returns the currently active policy.
+func (e *PolicyEngine) Policy() *Policy {
+	return e.policy.Load()
+}
+
+// Reload re-reads the policy file. A file that fails to parse leaves the
+// previous policy in place.
+func (e *PolicyEngine) Reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat policy file: %w", err)
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.path, err)
+	}
+
+	e.policy.Store(policy)
+	e.modTime = info.ModTime()
+	e.size = info.Size()
+	return nil
+}
+
+func (e *PolicyEngine) changed() bool {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return !info.ModTime().Equal(e.modTime) || info.Size() != e.size
+}
+
+// Watch polls the policy file every interval and reloads it when its
+// modification time or size changes, until ctx is cancelled.
+func (e *PolicyEngine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.changed() {
+				continue
+			}
+			if err := e.Reload(); err != nil {
+				slog.Error("Policy reload failed, keeping previous policy", "file", e.path, "error", err)
+				continue
+			}
+			slog.Info("Reloaded access policy", "file", e.path)
+		}
+	}
+}
+
+// PolicyContextKey holds the policy check a request passed.
+const PolicyContextKey contextKey = "policy"
+
+// policyCheck is the policy a request was checked against and the path prefix
+// removed before matching.
+type policyCheck struct {
+	policy *Policy
+	prefix string
+}
+
+func (c policyCheck) evaluate(r *http.Request, requestPath string) (bool, string) {
+	return c.policy.Evaluate(r.Method, strings.TrimPrefix(requestPath, c.prefix), RequestAttributes(r.Context()))
+}
+
+// PolicyMiddleware enforces the engine's policy. It must run after
+// TokenMiddleware or ClientCertMiddleware so the identity is in the context.
+func PolicyMiddleware(engine *PolicyEngine, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			check := policyCheck{policy: engine.Policy(), prefix: o.pathPrefix}
+			allowed, rule := check.evaluate(r, r.URL.Path)
+			if !allowed {
+				logging.FromContext(r.Context()).Warn("Access denied by policy", "path", r.URL.Path, "rule", rule)
+				o.errorHandler(w, r, http.StatusForbidden, "Access denied")
+				return
+			}
+			ctx := context.WithValue(r.Context(), PolicyContextKey, check)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AllowedPath evaluates the policy PolicyMiddleware checked r against for
+// another path, e.g. the index file a directory request resolves to, so
+// handlers can't serve an object the policy denies. requestPath is stripped
+// of the WithPathPrefix prefix like the request path. Without a policy every
+// path is allowed.
+func AllowedPath(r *http.Request, requestPath string) (bool, string) {
+	check, ok := r.Context().Value(PolicyContextKey).(policyCheck)
+	if !ok {
+		return true, ""
+	}
+	return check.evaluate(r, requestPath)
+}
+
+// RequestAttributes collects policy attributes from the token or client
+// certificate identity stored in ctx.
+func RequestAttributes(ctx context.Context) Attributes {
+	attrs := Attributes{}
+
+	if t := GetTokenFromContext(ctx); t != nil {
+		attrs["auth"] = []string{"token"}
+		attrs["id"] = []string{t.ID}
+		if t.Subject != "" {
+			attrs["sub"] = []string{t.Subject}
+		}
+		if len(t.Roles) > 0 {
+			attrs["role"] = t.Roles
+		}
+	}
+
+	if identity := GetClientIdentityFromContext(ctx); identity != nil {
+		attrs["auth"] = append(attrs["auth"], "mtls")
+		attrs["sub"] = append(attrs["sub"], identity.Subject)
+		if identity.CommonName != "" {
+			attrs["cn"] = []string{identity.CommonName}
+		}
+		var sans []string
+		sans = append(sans, identity.DNSNames...)
+		sans = append(sans, identity.EmailAddresses...)
+		sans = append(sans, identity.URIs...)
+		if len(sans) > 0 {
+			attrs["san"] = sans
+		}
+	}
+
+	return attrs
+}
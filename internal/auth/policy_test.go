@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: partners
+    effect: allow
+    paths: ["/docs/partners/**"]
+    methods: [get, head]
+    when:
+      role: [partner]
+  - name: no-drafts
+    effect: deny
+    paths: ["/docs/drafts/**"]
+  - name: employees
+    effect: allow
+    paths: ["/docs/**"]
+    when:
+      role: [employee]
+`
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Failed to parse policy: %v", err)
+	}
+
+	partner := Attributes{"role": {"partner"}}
+	employee := Attributes{"role": {"employee"}}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		attrs    Attributes
+		expected bool
+		rule     string
+	}{
+		{"partner in partner area", "GET", "/docs/partners/guide.html", partner, true, "partners"},
+		{"partner area root", "GET", "/docs/partners", partner, true, "partners"},
+		{"partner outside partner area", "GET", "/docs/internal/guide.html", partner, false, "default"},
+		{"partner with disallowed method", "POST", "/docs/partners/guide.html", partner, false, "default"},
+		{"partner escaping with dot segments", "GET", "/docs/partners/../internal/guide.html", partner, false, "default"},
+		{"employee anywhere", "GET", "/docs/internal/guide.html", employee, true, "employees"},
+		{"employee in drafts", "GET", "/docs/drafts/next.html", employee, false, "no-drafts"},
+		{"no roles", "GET", "/docs/index.html", Attributes{}, false, "default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, rule := policy.Evaluate(tt.method, tt.path, tt.attrs)
+			if allowed != tt.expected {
+				t.Errorf("Evaluate() allowed = %v, want %v", allowed, tt.expected)
+			}
+			if rule != tt.rule {
+				t.Errorf("Evaluate() rule = %q, want %q", rule, tt.rule)
+			}
+		})
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := map[string]string{
+		"bad effect":    `rules: [{effect: maybe}]`,
+		"bad default":   `default: sometimes`,
+		"bad pattern":   `rules: [{effect: allow, paths: ["/docs/[x"]}]`,
+		"unknown field": `rules: [{effect: allow, roles: [admin]}]`,
+	}
+
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParsePolicy([]byte(doc)); err == nil {
+				t.Error("Expected error for invalid policy")
+			}
+		})
+	}
+}
+
+func TestParsePolicyJSON(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`{"default": "allow", "rules": [{"effect": "deny", "paths": ["/docs/secret/*"]}]}`))
+	if err != nil {
+		t.Fatalf("Failed to parse JSON policy: %v", err)
+	}
+
+	if allowed, _ := policy.Evaluate("GET", "/docs/secret/a.html", nil); allowed {
+		t.Error("Expected secret document to be denied")
+	}
+	if allowed, _ := policy.Evaluate("GET", "/docs/a.html", nil); !allowed {
+		t.Error("Expected default allow")
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/docs/**", "/docs/a/b/c.html", true},
+		{"/docs/**", "/docs/", true},
+		{"/docs/*.html", "/docs/index.html", true},
+		{"/docs/*.html", "/docs/a/index.html", false},
+		{"/docs/**/*.pdf", "/docs/a/b/manual.pdf", true},
+		{"/docs/**/*.pdf", "/docs/manual.pdf", true},
+		{"/docs/partners/**", "/docs/partnership/a.html", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			if result := matchPath(tt.pattern, tt.path); result != tt.expected {
+				t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEngineReload(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte("default: deny\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewPolicyEngine(policyFile)
+	if err != nil {
+		t.Fatalf("Failed to create policy engine: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx, 10*time.Millisecond)
+
+	if allowed, _ := engine.Policy().Evaluate("GET", "/docs/a.html", nil); allowed {
+		t.Fatal("Expected initial policy to deny")
+	}
+
+	if err := os.WriteFile(policyFile, []byte("default: allow\nrules: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if allowed, _ := engine.Policy().Evaluate("GET", "/docs/a.html", nil); allowed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Expected policy to be reloaded after file change")
+}
+
+func TestPolicyEngineKeepsPolicyOnBadReload(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte("default: allow\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewPolicyEngine(policyFile)
+	if err != nil {
+		t.Fatalf("Failed to create policy engine: %v", err)
+	}
+
+	if err := os.WriteFile(policyFile, []byte("default: [broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Reload(); err == nil {
+		t.Error("Expected reload error for invalid policy")
+	}
+
+	if allowed, _ := engine.Policy().Evaluate("GET", "/docs/a.html", nil); !allowed {
+		t.Error("Expected previous policy to remain active")
+	}
+}
+
+func TestPolicyMiddleware(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	engine, err := NewPolicyEngine(policyFile)
+	if err != nil {
+		t.Fatalf("Failed to create policy engine: %v", err)
+	}
+
+	tokenManager := token.NewManager("test-secret")
+	partnerToken, err := tokenManager.Generate(time.Hour, token.WithRoles("partner"))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := TokenMiddleware(tokenManager)(PolicyMiddleware(engine)(next))
+	prefixed := TokenMiddleware(tokenManager)(PolicyMiddleware(engine, WithPathPrefix("/acme"))(next))
+
+	tests := []struct {
+		name           string
+		handler        http.Handler
+		path           string
+		expectedStatus int
+	}{
+		{"allowed", handler, "/docs/partners/guide.html", http.StatusOK},
+		{"denied", handler, "/docs/internal/guide.html", http.StatusForbidden},
+		{"prefix stripped", prefixed, "/acme/docs/partners/guide.html", http.StatusOK},
+		{"prefix stripped denied", prefixed, "/acme/docs/internal/guide.html", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+partnerToken)
+
+			rr := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
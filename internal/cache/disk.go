@@ -0,0 +1,373 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// tempPrefix marks partially written files; they are removed on startup.
+const tempPrefix = ".tmp-"
+
+// diskEntry is one cached object generation. Files are named
+// <sha256(path)>-<generation> so a new generation can replace the old one.
+type diskEntry struct {
+	name       string
+	pathHash   string
+	generation int64
+	size       int64
+}
+
+// DiskCache keeps object content in a local directory, bounded by total bytes
+// with LRU eviction. Every request still reads the object's attributes from
+// the backend, and the cached copy is only used while its generation matches.
+type DiskCache struct {
+	backend storage.Backend
+	dir     string
+	opts    Options
+
+	mu      sync.Mutex
+	ll      *list.List
+	items   map[string]*list.Element // file name -> entry
+	current map[string]string        // path hash -> file name of its cached generation
+	filling map[string]bool          // file names being written by a fillReader
+	bytes   int64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// NewDiskCache creates dir if needed and indexes the files already in it, so
+// a restarted container keeps what it had cached. Only MaxBytes and
+// MaxObjectSize are used from opts.
+func NewDiskCache(backend storage.Backend, dir string, opts Options) (*DiskCache, error) {
+	if opts.MaxObjectSize > opts.MaxBytes {
+		opts.MaxObjectSize = opts.MaxBytes
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	c := &DiskCache{
+		backend: backend,
+		dir:     dir,
+		opts:    opts,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+		current: make(map[string]string),
+		filling: make(map[string]bool),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load indexes existing cache files, least recently modified first.
+func (c *DiskCache) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	type found struct {
+		entry   *diskEntry
+		modTime int64
+	}
+	var files []found
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if strings.HasPrefix(name, tempPrefix) {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		e, ok := parseEntryName(name)
+		if !ok || !dirEntry.Type().IsRegular() {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		e.size = info.Size()
+		files = append(files, found{e, info.ModTime().UnixNano()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime < files[j].modTime })
+	for _, f := range files {
+		c.add(f.entry)
+	}
+	return nil
+}
+
+func (c *DiskCache) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	fileInfo, err := c.backend.GetFile(ctx, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	// Without a generation a cached copy can't be validated
+	if fileInfo.Generation == 0 || fileInfo.Size > c.opts.MaxObjectSize {
+		return fileInfo, nil
+	}
+
+	name := entryName(objectPath, fileInfo.Generation)
+	if file := c.open(name); file != nil {
+		c.hits.Add(1)
+		fileInfo.Content.Close()
+		fileInfo.Content = file
+		return fileInfo, nil
+	}
+	c.misses.Add(1)
+
+	// The object is streamed from the backend as usual and copied to disk
+	// only if the response reads all of it from the start, so HEAD, 304 and
+	// Range requests never download more than they serve.
+	fileInfo.Content = &fillReader{
+		ReadSeekCloser: fileInfo.Content,
+		cache:          c,
+		name:           name,
+		objectPath:     objectPath,
+		size:           fileInfo.Size,
+		logger:         logging.FromContext(ctx),
+	}
+	return fileInfo, nil
+}
+
+// fillReader copies what is read from an uncached object into a temporary
+// file, and renames it into place once the whole object has been read in
+// order. A read elsewhere, a failed write or a Close before the end abandons
+// the copy. Only one reader fills a given file at a time.
+type fillReader struct {
+	io.ReadSeekCloser
+	cache      *DiskCache
+	name       string
+	objectPath string
+	size       int64
+	logger     *slog.Logger
+
+	pos     int64 // read offset
+	written int64 // bytes copied to tmp
+	tmp     *os.File
+	skipped bool
+}
+
+func (r *fillReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeekCloser.Read(p)
+	if n > 0 && !r.skipped {
+		r.copy(p[:n])
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *fillReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.ReadSeekCloser.Seek(offset, whence)
+	if err == nil {
+		r.pos = pos
+	}
+	return pos, err
+}
+
+func (r *fillReader) Close() error {
+	r.abandon()
+	return r.ReadSeekCloser.Close()
+}
+
+func (r *fillReader) copy(p []byte) {
+	if r.tmp != nil && r.pos != r.written {
+		r.abandon()
+		return
+	}
+	if r.tmp == nil {
+		if r.pos != 0 || !r.cache.claim(r.name) {
+			r.skipped = true
+			return
+		}
+		tmp, err := os.CreateTemp(r.cache.dir, tempPrefix)
+		if err != nil {
+			r.logger.Warn("Disk cache fill failed", "object", r.objectPath, "error", err)
+			r.cache.release(r.name)
+			r.skipped = true
+			return
+		}
+		r.tmp = tmp
+	}
+
+	if _, err := r.tmp.Write(p); err != nil {
+		r.logger.Warn("Disk cache fill failed", "object", r.objectPath, "error", err)
+		r.abandon()
+		return
+	}
+	r.written += int64(len(p))
+	if r.written == r.size {
+		r.finish()
+	}
+}
+
+// finish moves the complete copy into the cache.
+func (r *fillReader) finish() {
+	tmp := r.tmp
+	r.tmp, r.skipped = nil, true
+	defer r.cache.release(r.name)
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Close(); err != nil {
+		r.logger.Warn("Disk cache fill failed", "object", r.objectPath, "error", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(r.cache.dir, r.name)); err != nil {
+		r.logger.Warn("Disk cache fill failed", "object", r.objectPath, "error", fmt.Errorf("failed to store cache file: %w", err))
+		return
+	}
+
+	e, _ := parseEntryName(r.name)
+	e.size = r.size
+	r.cache.add(e)
+}
+
+func (r *fillReader) abandon() {
+	r.skipped = true
+	if r.tmp == nil {
+		return
+	}
+	r.tmp.Close()
+	os.Remove(r.tmp.Name())
+	r.tmp = nil
+	r.cache.release(r.name)
+}
+
+// claim reports whether the caller may fill name, i.e. no other reader is.
+func (c *DiskCache) claim(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.filling[name] {
+		return false
+	}
+	c.filling[name] = true
+	return true
+}
+
+func (c *DiskCache) release(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.filling, name)
+}
+
+// open returns the cached file and marks it recently used, or nil if it isn't
+// cached.
+func (c *DiskCache) open(name string) *os.File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[name]
+	if !ok {
+		return nil
+	}
+	file, err := os.Open(filepath.Join(c.dir, name))
+	if err != nil {
+		// Removed behind our back; forget it
+		c.unlink(elem)
+		return nil
+	}
+	c.ll.MoveToFront(elem)
+	return file
+}
+
+// add indexes a new file, replacing any other generation of the same object,
+// and evicts least recently used files until the cache fits in MaxBytes. A
+// file older than the generation already cached is deleted instead.
+func (c *DiskCache) add(e *diskEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if previous, ok := c.current[e.pathHash]; ok {
+		elem := c.items[previous]
+		switch {
+		case previous == e.name:
+			c.unlink(elem)
+		case elem.Value.(*diskEntry).generation > e.generation:
+			os.Remove(filepath.Join(c.dir, e.name))
+			return
+		default:
+			c.remove(elem)
+		}
+	}
+
+	c.items[e.name] = c.ll.PushFront(e)
+	c.current[e.pathHash] = e.name
+	c.bytes += e.size
+
+	for c.bytes > c.opts.MaxBytes {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.remove(oldest)
+		c.evictions.Add(1)
+	}
+}
+
+// remove deletes the file and its index entry; it must be called with c.mu
+// held. Readers that already opened the file keep reading it.
+func (c *DiskCache) remove(elem *list.Element) {
+	e := c.unlink(elem)
+	if err := os.Remove(filepath.Join(c.dir, e.name)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove cache file", "file", e.name, "error", err)
+	}
+}
+
+// unlink drops the index entry but leaves the file; it must be called with
+// c.mu held.
+func (c *DiskCache) unlink(elem *list.Element) *diskEntry {
+	e := c.ll.Remove(elem).(*diskEntry)
+	delete(c.items, e.name)
+	delete(c.current, e.pathHash)
+	c.bytes -= e.size
+	return e
+}
+
+func (c *DiskCache) Stats() Stats {
+	c.mu.Lock()
+	entries, size := c.ll.Len(), c.bytes
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     size,
+	}
+}
+
+func entryName(objectPath string, generation int64) string {
+	sum := sha256.Sum256([]byte(objectPath))
+	return hex.EncodeToString(sum[:]) + "-" + strconv.FormatInt(generation, 10)
+}
+
+func parseEntryName(name string) (*diskEntry, bool) {
+	pathHash, gen, ok := strings.Cut(name, "-")
+	if !ok || len(pathHash) != sha256.Size*2 {
+		return nil, false
+	}
+	generation, err := strconv.ParseInt(gen, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &diskEntry{name: name, pathHash: pathHash, generation: generation}, true
+}
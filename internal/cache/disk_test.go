@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func cacheFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestDiskCacheHit(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{objects: map[string]string{"slides.pdf": "%PDF-1.7"}}
+	c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		fileInfo, err := c.GetFile(context.Background(), "slides.pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readAll(t, fileInfo); got != "%PDF-1.7" {
+			t.Errorf("Unexpected content %q", got)
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 8 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if files := cacheFiles(t, dir); len(files) != 1 || files[0] != entryName("slides.pdf", 1) {
+		t.Errorf("Unexpected cache files %v", files)
+	}
+}
+
+func TestDiskCacheNewGeneration(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{objects: map[string]string{"slides.pdf": "v1"}}
+	c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileInfo, _ := c.GetFile(context.Background(), "slides.pdf")
+	readAll(t, fileInfo)
+
+	backend.set("slides.pdf", "v2")
+	fileInfo, err = c.GetFile(context.Background(), "slides.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fileInfo); got != "v2" {
+		t.Errorf("Expected new generation to be served, got %q", got)
+	}
+
+	if files := cacheFiles(t, dir); len(files) != 1 || files[0] != entryName("slides.pdf", 2) {
+		t.Errorf("Expected only the new generation on disk, got %v", files)
+	}
+}
+
+func TestDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{objects: map[string]string{
+		"a.png": strings.Repeat("a", 400),
+		"b.png": strings.Repeat("b", 400),
+		"c.png": strings.Repeat("c", 400),
+	}}
+	c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1000, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a.png", "b.png", "a.png", "c.png"} {
+		fileInfo, err := c.GetFile(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readAll(t, fileInfo)
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Entries != 2 || stats.Bytes != 800 {
+		t.Errorf("Unexpected stats after eviction %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, entryName("b.png", 1))); !os.IsNotExist(err) {
+		t.Error("Expected least recently used file to be deleted")
+	}
+}
+
+func TestDiskCacheLargeObjectsPassThrough(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{objects: map[string]string{"lecture.mp4": strings.Repeat("v", 600)}}
+	c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileInfo, err := c.GetFile(context.Background(), "lecture.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, fileInfo); len(got) != 600 {
+		t.Errorf("Expected 600 bytes, got %d", len(got))
+	}
+	if files := cacheFiles(t, dir); len(files) != 0 {
+		t.Errorf("Large object should not be written to disk, got %v", files)
+	}
+}
+
+func TestDiskCacheReload(t *testing.T) {
+	dir := t.TempDir()
+	backend := &fakeBackend{objects: map[string]string{"slides.pdf": "%PDF-1.7"}}
+	c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := c.GetFile(context.Background(), "slides.pdf")
+	readAll(t, fileInfo)
+
+	// Leftover from an interrupted download
+	if err := os.WriteFile(filepath.Join(dir, tempPrefix+"123"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := c.Stats(); stats.Entries != 1 || stats.Bytes != 8 {
+		t.Errorf("Expected existing file to be indexed, got %+v", stats)
+	}
+	if files := cacheFiles(t, dir); len(files) != 1 {
+		t.Errorf("Expected temporary file to be removed, got %v", files)
+	}
+
+	fileInfo, _ = c.GetFile(context.Background(), "slides.pdf")
+	readAll(t, fileInfo)
+	if c.Stats().Hits != 1 {
+		t.Error("Expected a hit after restart")
+	}
+}
+
+func TestDiskCacheFillsOnlyFullReads(t *testing.T) {
+	serve := func(header string) func(t *testing.T, content io.ReadSeeker) {
+		return func(t *testing.T, content io.ReadSeeker) {
+			req := httptest.NewRequest("GET", "/slides.pdf", nil)
+			if header != "" {
+				name, value, _ := strings.Cut(header, ": ")
+				req.Header.Set(name, value)
+			}
+			rr := httptest.NewRecorder()
+			rr.Header().Set("ETag", `"1"`)
+			http.ServeContent(rr, req, "slides.pdf", time.Time{}, content)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		read          func(t *testing.T, content io.ReadSeeker)
+		expectedFiles int
+	}{
+		{"full GET", serve(""), 1},
+		{"HEAD", func(t *testing.T, content io.ReadSeeker) {
+			http.ServeContent(httptest.NewRecorder(), httptest.NewRequest("HEAD", "/slides.pdf", nil), "slides.pdf", time.Time{}, content)
+		}, 0},
+		{"not modified", serve(`If-None-Match: "1"`), 0},
+		{"range from an offset", serve("Range: bytes=4-"), 0},
+		{"range from the start", serve("Range: bytes=0-3"), 0},
+		{"read after a seek back", func(t *testing.T, content io.ReadSeeker) {
+			buf := make([]byte, 4)
+			content.Read(buf)
+			content.Seek(2, io.SeekStart)
+			io.ReadAll(content)
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			backend := &fakeBackend{objects: map[string]string{"slides.pdf": "%PDF-1.7"}}
+			c, err := NewDiskCache(backend, dir, Options{MaxBytes: 1024, MaxObjectSize: 512})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fileInfo, err := c.GetFile(context.Background(), "slides.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.read(t, fileInfo.Content)
+			fileInfo.Content.Close()
+
+			if files := cacheFiles(t, dir); len(files) != tt.expectedFiles {
+				t.Errorf("Expected %d cache files, got %v", tt.expectedFiles, files)
+			}
+			if entries := c.Stats().Entries; entries != tt.expectedFiles {
+				t.Errorf("Expected %d entries, got %d", tt.expectedFiles, entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// WatchManifest polls the generation of a manifest object every interval and
+// calls onChange when it differs from the last one seen, until ctx is
+// cancelled. Publishing tools rewrite the manifest after an upload, so its
+// generation changes once per publish. A missing manifest counts as
+// generation 0, and the first successful read only records the generation.
+func WatchManifest(ctx context.Context, backend storage.Backend, objectPath string, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last int64
+	seen := false
+	check := func() {
+		generation, err := manifestGeneration(ctx, backend, objectPath)
+		if err != nil {
+			slog.Warn("Failed to check cache manifest", "object", objectPath, "error", err)
+			return
+		}
+		if seen && generation != last {
+			slog.Info("Cache manifest changed", "object", objectPath, "generation", generation)
+			onChange()
+		}
+		last, seen = generation, true
+	}
+
+	check()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+func manifestGeneration(ctx context.Context, backend storage.Backend, objectPath string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	fileInfo, err := backend.GetFile(ctx, objectPath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	fileInfo.Content.Close()
+	return fileInfo.Generation, nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchManifest(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var changes atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		WatchManifest(ctx, backend, ".published", 10*time.Millisecond, func() { changes.Add(1) })
+		close(done)
+	}()
+
+	waitFor := func(want int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for changes.Load() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d changes, got %d", want, changes.Load())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// Missing manifest is recorded, not reported
+	time.Sleep(50 * time.Millisecond)
+	waitFor(0)
+
+	backend.set(".published", "2024-05-01")
+	waitFor(1)
+
+	time.Sleep(50 * time.Millisecond)
+	waitFor(1)
+
+	backend.set(".published", "2024-05-02")
+	waitFor(2)
+
+	cancel()
+	<-done
+}
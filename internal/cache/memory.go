@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// fetchTimeout bounds a shared fetch, which deliberately outlives the
+// cancellation of the request that started it.
+const fetchTimeout = 30 * time.Second
+
+// markerWeight is charged against MaxBytes for entries without content
+// (missing and too-large objects), so random misses can't grow the cache
+// without bound.
+const markerWeight = 256
+
+// sweepInterval is how often expired entries are dropped.
+const sweepInterval = time.Minute
+
+type Options struct {
+	// MaxBytes bounds the total size of cached content.
+	MaxBytes int64
+	// MaxObjectSize is the largest object kept in memory; bigger objects are
+	// passed through to the backend.
+	MaxObjectSize int64
+	// TTL is how long an object is served from memory before it is fetched
+	// again; NegativeTTL is the same for objects that don't exist.
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+// Stats are cumulative cache counters.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+}
+
+type entry struct {
+	key      string
+	data     []byte
+	info     storage.FileInfo // metadata only; Content is nil
+	notFound bool
+	large    bool // too big to cache; go straight to the backend
+	expires  time.Time
+}
+
+// MemoryCache is a size-bounded LRU cache of small objects in front of a
+// storage.Backend. Concurrent misses for the same object share one fetch.
+type MemoryCache struct {
+	backend storage.Backend
+	opts    Options
+	now     func() time.Time
+
+	mu        sync.Mutex
+	ll        *list.List
+	items     map[string]*list.Element
+	bytes     int64 // cached content
+	weight    int64 // content plus markers, bounded by MaxBytes
+	lastSweep time.Time
+
+	group singleflight.Group
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func NewMemoryCache(backend storage.Backend, opts Options) *MemoryCache {
+	if opts.NegativeTTL == 0 || opts.NegativeTTL > opts.TTL {
+		opts.NegativeTTL = opts.TTL
+	}
+	if opts.MaxObjectSize > opts.MaxBytes {
+		opts.MaxObjectSize = opts.MaxBytes
+	}
+	return &MemoryCache{
+		backend: backend,
+		opts:    opts,
+		now:     time.Now,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	if e := c.lookup(objectPath); e != nil {
+		switch {
+		case e.notFound:
+			c.hits.Add(1)
+			return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+		case e.large:
+			c.misses.Add(1)
+			return c.backend.GetFile(ctx, objectPath)
+		default:
+			c.hits.Add(1)
+			return e.fileInfo(), nil
+		}
+	}
+	c.misses.Add(1)
+
+	v, err, _ := c.group.Do(objectPath, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+
+		if err := c.fetch(fetchCtx, objectPath); err != nil {
+			return nil, err
+		}
+		return c.lookup(objectPath), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Objects too large to cache are read by each caller with its own
+	// context; a reader bound to the shared fetch would outlive it.
+	e, _ := v.(*entry)
+	if e == nil || e.large {
+		return c.backend.GetFile(ctx, objectPath)
+	}
+	return e.fileInfo(), nil
+}
+
+// fetch loads an object from the backend into the cache, or records that it
+// is missing or too large to cache.
+func (c *MemoryCache) fetch(ctx context.Context, objectPath string) error {
+	fileInfo, err := c.backend.GetFile(ctx, objectPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.store(&entry{key: objectPath, notFound: true, expires: c.now().Add(c.opts.NegativeTTL)})
+		}
+		return err
+	}
+
+	if fileInfo.Size > c.opts.MaxObjectSize {
+		fileInfo.Content.Close()
+		c.store(&entry{key: objectPath, large: true, expires: c.now().Add(c.opts.TTL)})
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(fileInfo.Content, c.opts.MaxObjectSize+1))
+	fileInfo.Content.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", objectPath, err)
+	}
+	if int64(len(data)) != fileInfo.Size {
+		return fmt.Errorf("failed to read %s: got %d of %d bytes", objectPath, len(data), fileInfo.Size)
+	}
+
+	e := &entry{key: objectPath, data: data, info: *fileInfo, expires: c.now().Add(c.opts.TTL)}
+	e.info.Content = nil
+	c.store(e)
+	return nil
+}
+
+func (c *MemoryCache) lookup(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.remove(elem)
+		return nil
+	}
+	c.ll.MoveToFront(elem)
+	return e
+}
+
+func (c *MemoryCache) store(e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[e.key]; ok {
+		c.remove(elem)
+	}
+	c.sweep()
+	c.items[e.key] = c.ll.PushFront(e)
+	c.bytes += int64(len(e.data))
+	c.weight += e.weight()
+
+	for c.weight > c.opts.MaxBytes {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.remove(oldest)
+		c.evictions.Add(1)
+	}
+}
+
+// sweep drops expired entries at most once per sweepInterval. It must be
+// called with c.mu held.
+func (c *MemoryCache) sweep() {
+	now := c.now()
+	if now.Sub(c.lastSweep) < sweepInterval {
+		return
+	}
+	c.lastSweep = now
+
+	for _, elem := range c.items {
+		if !now.Before(elem.Value.(*entry).expires) {
+			c.remove(elem)
+		}
+	}
+}
+
+// remove must be called with c.mu held.
+func (c *MemoryCache) remove(elem *list.Element) {
+	e := c.ll.Remove(elem).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= int64(len(e.data))
+	c.weight -= e.weight()
+}
+
+// Purge drops the given object paths and every object under the given
+// prefixes, and returns the number of entries removed.
+func (c *MemoryCache) Purge(paths, prefixes []string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for _, objectPath := range paths {
+		if elem, ok := c.items[objectPath]; ok {
+			c.remove(elem)
+			purged++
+		}
+	}
+	if len(prefixes) == 0 {
+		return purged
+	}
+	for key, elem := range c.items {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				c.remove(elem)
+				purged++
+				break
+			}
+		}
+	}
+	return purged
+}
+
+// PurgeAll empties the cache and returns the number of entries removed.
+func (c *MemoryCache) PurgeAll() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := c.ll.Len()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes, c.weight = 0, 0
+	return purged
+}
+
+func (c *MemoryCache) Stats() Stats {
+	c.mu.Lock()
+	entries, size := c.ll.Len(), c.bytes
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Entries:   entries,
+		Bytes:     size,
+	}
+}
+
+func (e *entry) weight() int64 {
+	if e.data == nil {
+		return markerWeight
+	}
+	return int64(len(e.data))
+}
+
+func (e *entry) fileInfo() *storage.FileInfo {
+	info := e.info
+	info.Content = nopCloser{bytes.NewReader(e.data)}
+	return &info
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,365 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+// fakeBackend serves objects from a map and counts GetFile calls. Each set
+// bumps the object's generation. When gate is set, GetFile blocks until it is
+// closed.
+type fakeBackend struct {
+	mu          sync.Mutex
+	objects     map[string]string
+	generations map[string]int64
+	calls       atomic.Int32
+	gate        chan struct{}
+}
+
+func (b *fakeBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	b.calls.Add(1)
+	if b.gate != nil {
+		<-b.gate
+	}
+
+	b.mu.Lock()
+	content, ok := b.objects[objectPath]
+	generation := b.generations[objectPath] + 1
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+	}
+
+	return &storage.FileInfo{
+		Content:     nopCloser{strings.NewReader(content)},
+		ContentType: "text/html; charset=utf-8",
+		Size:        int64(len(content)),
+		Generation:  generation,
+	}, nil
+}
+
+func (b *fakeBackend) set(objectPath, content string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[objectPath] = content
+	if b.generations == nil {
+		b.generations = make(map[string]int64)
+	}
+	b.generations[objectPath]++
+}
+
+func readAll(t *testing.T, fileInfo *storage.FileInfo) string {
+	t.Helper()
+	defer fileInfo.Content.Close()
+	data, err := io.ReadAll(fileInfo.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestMemoryCacheHit(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{"index.html": "<h1>Home</h1>"}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		fileInfo, err := c.GetFile(ctx, "index.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readAll(t, fileInfo); got != "<h1>Home</h1>" {
+			t.Errorf("Unexpected content %q", got)
+		}
+		if fileInfo.Generation != 1 || fileInfo.ContentType != "text/html; charset=utf-8" {
+			t.Errorf("Metadata not preserved: %+v", fileInfo)
+		}
+	}
+
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Errorf("Expected 1 backend call, got %d", calls)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 13 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{"index.html": "v1"}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	fileInfo, _ := c.GetFile(ctx, "index.html")
+	readAll(t, fileInfo)
+
+	backend.set("index.html", "v2")
+	now = now.Add(30 * time.Second)
+	fileInfo, _ = c.GetFile(ctx, "index.html")
+	if got := readAll(t, fileInfo); got != "v1" {
+		t.Errorf("Expected cached v1 within TTL, got %q", got)
+	}
+
+	now = now.Add(31 * time.Second)
+	fileInfo, _ = c.GetFile(ctx, "index.html")
+	if got := readAll(t, fileInfo); got != "v2" {
+		t.Errorf("Expected v2 after TTL, got %q", got)
+	}
+}
+
+func TestMemoryCacheNotFound(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		_, err := c.GetFile(context.Background(), "page.html.br")
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+	}
+
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Errorf("Expected missing object to be cached, got %d backend calls", calls)
+	}
+}
+
+func TestMemoryCacheLargeObjectsPassThrough(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{"lecture.mp4": strings.Repeat("v", 600)}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		fileInfo, err := c.GetFile(context.Background(), "lecture.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readAll(t, fileInfo); len(got) != 600 {
+			t.Errorf("Expected 600 bytes, got %d", len(got))
+		}
+	}
+
+	if stats := c.Stats(); stats.Bytes != 0 {
+		t.Errorf("Large object should not be held in memory, got %d bytes", stats.Bytes)
+	}
+	// The first request fetches again to read with its own context
+	if calls := backend.calls.Load(); calls != 3 {
+		t.Errorf("Expected 3 backend calls, got %d", calls)
+	}
+}
+
+// ctxBackend returns readers that fail once the context of the GetFile call
+// is done, like the lazy range readers of the GCS client.
+type ctxBackend struct {
+	fakeBackend
+}
+
+func (b *ctxBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	fileInfo, err := b.fakeBackend.GetFile(ctx, objectPath)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo.Content = ctxReader{ctx: ctx, ReadSeekCloser: fileInfo.Content}
+	return fileInfo, nil
+}
+
+type ctxReader struct {
+	ctx context.Context
+	io.ReadSeekCloser
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadSeekCloser.Read(p)
+}
+
+func TestMemoryCacheLargeObjectUsesCallerContext(t *testing.T) {
+	backend := &ctxBackend{fakeBackend{objects: map[string]string{"lecture.mp4": strings.Repeat("v", 600)}}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		fileInfo, err := c.GetFile(context.Background(), "lecture.mp4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := readAll(t, fileInfo); len(got) != 600 {
+			t.Errorf("Request %d: expected 600 bytes, got %d", i+1, len(got))
+		}
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{
+		"a.html": strings.Repeat("a", 400),
+		"b.html": strings.Repeat("b", 400),
+		"c.html": strings.Repeat("c", 400),
+	}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1000, MaxObjectSize: 512, TTL: time.Minute})
+	ctx := context.Background()
+
+	for _, name := range []string{"a.html", "b.html", "a.html", "c.html"} {
+		fileInfo, err := c.GetFile(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readAll(t, fileInfo)
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 1 || stats.Entries != 2 || stats.Bytes != 800 {
+		t.Errorf("Unexpected stats after eviction %+v", stats)
+	}
+
+	// b was least recently used
+	before := backend.calls.Load()
+	fileInfo, _ := c.GetFile(ctx, "a.html")
+	readAll(t, fileInfo)
+	if backend.calls.Load() != before {
+		t.Error("Expected a.html to stay cached")
+	}
+	fileInfo, _ = c.GetFile(ctx, "b.html")
+	readAll(t, fileInfo)
+	if backend.calls.Load() != before+1 {
+		t.Error("Expected b.html to have been evicted")
+	}
+}
+
+func TestMemoryCacheBoundsMarkers(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 4 * markerWeight, MaxObjectSize: 512, TTL: time.Minute})
+
+	for i := 0; i < 100; i++ {
+		c.GetFile(context.Background(), fmt.Sprintf("probe-%d.html", i))
+	}
+	if entries := c.Stats().Entries; entries != 4 {
+		t.Errorf("Expected missing objects to be evicted down to 4 entries, got %d", entries)
+	}
+}
+
+func TestMemoryCacheSweepsExpired(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{"index.html": "<h1>Home</h1>"}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1 << 20, MaxObjectSize: 512, TTL: time.Minute})
+	now := time.Unix(1700000000, 0)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		c.GetFile(ctx, fmt.Sprintf("probe-%d.html", i))
+	}
+	now = now.Add(2 * time.Minute)
+	fileInfo, err := c.GetFile(ctx, "index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	readAll(t, fileInfo)
+
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("Expected expired entries to be swept, got %d entries", entries)
+	}
+}
+
+func TestMemoryCacheSingleflight(t *testing.T) {
+	backend := &fakeBackend{
+		objects: map[string]string{"index.html": "<h1>Home</h1>"},
+		gate:    make(chan struct{}),
+	}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+
+	const requests = 10
+	var wg sync.WaitGroup
+	results := make(chan string, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fileInfo, err := c.GetFile(context.Background(), "index.html")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := io.ReadAll(fileInfo.Content)
+			results <- string(data)
+		}()
+	}
+
+	// Give the goroutines time to pile up behind the first fetch
+	time.Sleep(50 * time.Millisecond)
+	close(backend.gate)
+	wg.Wait()
+	close(results)
+
+	for result := range results {
+		if result != "<h1>Home</h1>" {
+			t.Errorf("Unexpected content %q", result)
+		}
+	}
+	if calls := backend.calls.Load(); calls != 1 {
+		t.Errorf("Expected concurrent misses to share one fetch, got %d", calls)
+	}
+}
+
+func TestMemoryCachePurge(t *testing.T) {
+	backend := &fakeBackend{objects: map[string]string{
+		"course/index.html":    "index",
+		"course/index.html.br": "br",
+		"course/lab/1.html":    "lab 1",
+		"other/index.html":     "other",
+	}}
+	c := NewMemoryCache(backend, Options{MaxBytes: 1024, MaxObjectSize: 512, TTL: time.Minute})
+	ctx := context.Background()
+
+	load := func() {
+		for name := range backend.objects {
+			fileInfo, err := c.GetFile(ctx, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			readAll(t, fileInfo)
+		}
+		c.GetFile(ctx, "course/missing.html")
+	}
+
+	tests := []struct {
+		name     string
+		paths    []string
+		prefixes []string
+		want     int
+	}{
+		{"single path", []string{"course/index.html"}, nil, 1},
+		{"prefix", nil, []string{"course/"}, 4},
+		{"path and prefix", []string{"other/index.html"}, []string{"course/lab/"}, 2},
+		{"unknown path", []string{"nope.html"}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.PurgeAll()
+			load()
+			if got := c.Purge(tt.paths, tt.prefixes); got != tt.want {
+				t.Errorf("Purge() = %d, want %d", got, tt.want)
+			}
+			if entries := c.Stats().Entries; entries != 5-tt.want {
+				t.Errorf("Expected %d entries left, got %d", 5-tt.want, entries)
+			}
+		})
+	}
+
+	if got := c.PurgeAll(); got == 0 {
+		t.Error("Expected PurgeAll to remove entries")
+	}
+	if stats := c.Stats(); stats.Entries != 0 || stats.Bytes != 0 {
+		t.Errorf("Expected empty cache, got %+v", stats)
+	}
+}
@@ -0,0 +1,175 @@
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Brotli = "br"
+	Zstd   = "zstd"
+	Gzip   = "gzip"
+)
+
+// Encodings lists supported content codings in server preference order.
+var Encodings = []string{Brotli, Zstd, Gzip}
+
+// Extension returns the suffix of a precompressed sibling object, e.g.
+// "page.html.br" for Brotli.
+func Extension(encoding string) string {
+	switch encoding {
+	case Brotli:
+		return ".br"
+	case Zstd:
+		return ".zst"
+	case Gzip:
+		return ".gz"
+	default:
+		return ""
+	}
+}
+
+// Negotiate parses an Accept-Encoding header and returns the supported
+// encodings the client accepts, best first. Client q-values take precedence;
+// ties are broken by server preference.
+func Negotiate(acceptEncoding string) []string {
+	qualities := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, item := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if name == "*" {
+			wildcard = q
+		} else {
+			qualities[name] = q
+		}
+	}
+
+	type candidate struct {
+		encoding string
+		q        float64
+		rank     int
+	}
+	var candidates []candidate
+	for rank, encoding := range Encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{encoding, q, rank})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].rank < candidates[j].rank
+	})
+
+	encodings := make([]string, len(candidates))
+	for i, c := range candidates {
+		encodings[i] = c.encoding
+	}
+	return encodings
+}
+
+var compressibleTypes = map[string]bool{
+	"application/javascript": true,
+	"application/json":       true,
+	"application/xml":        true,
+	"application/xhtml+xml":  true,
+	"application/wasm":       true,
+	"image/svg+xml":          true,
+}
+
+// Compressible reports whether a content type is worth compressing. Images,
+// video, PDFs and archives are already compressed.
+func Compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		compressibleTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+var (
+	gzipPool   sync.Pool
+	brotliPool sync.Pool
+	zstdPool   sync.Pool
+)
+
+// NewWriter returns a writer that compresses into w. Close flushes the
+// encoder and returns it to a pool for reuse; it does not close w.
+func NewWriter(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case Gzip:
+		gz, ok := gzipPool.Get().(*gzip.Writer)
+		if ok {
+			gz.Reset(w)
+		} else {
+			gz = gzip.NewWriter(w)
+		}
+		return &pooledWriter{WriteCloser: gz, release: func() { gzipPool.Put(gz) }}, nil
+	case Brotli:
+		br, ok := brotliPool.Get().(*brotli.Writer)
+		if ok {
+			br.Reset(w)
+		} else {
+			br = brotli.NewWriterLevel(w, 5)
+		}
+		return &pooledWriter{WriteCloser: br, release: func() { brotliPool.Put(br) }}, nil
+	case Zstd:
+		zw, ok := zstdPool.Get().(*zstd.Encoder)
+		if ok {
+			zw.Reset(w)
+		} else {
+			var err error
+			zw, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+			}
+		}
+		return &pooledWriter{WriteCloser: zw, release: func() { zstdPool.Put(zw) }}, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+type pooledWriter struct {
+	io.WriteCloser
+	release func()
+}
+
+func (p *pooledWriter) Close() error {
+	err := p.WriteCloser.Close()
+	p.release()
+	return err
+}
@@ -0,0 +1,121 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected []string
+	}{
+		{"", nil},
+		{"identity", nil},
+		{"gzip", []string{"gzip"}},
+		{"gzip, deflate, br, zstd", []string{"br", "zstd", "gzip"}},
+		{"gzip;q=1.0, br;q=0.5", []string{"gzip", "br"}},
+		{"br;q=0, gzip", []string{"gzip"}},
+		{"*", []string{"br", "zstd", "gzip"}},
+		{"*;q=0.1, gzip", []string{"gzip", "br", "zstd"}},
+		{"GZIP ; q=0.8", []string{"gzip"}},
+		{"gzip;q=bogus", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			result := Negotiate(tt.header)
+			if strings.Join(result, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Negotiate(%q) = %v, want %v", tt.header, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		contentType string
+		expected    bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"text/css", true},
+		{"application/javascript; charset=utf-8", true},
+		{"image/svg+xml", true},
+		{"application/ld+json", true},
+		{"image/png", false},
+		{"application/pdf", false},
+		{"video/mp4", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if result := Compressible(tt.contentType); result != tt.expected {
+				t.Errorf("Compressible(%q) = %v, want %v", tt.contentType, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewWriterRoundTrip(t *testing.T) {
+	content := strings.Repeat("<p>Kafka course chapter</p>\n", 200)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		Gzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		Brotli: func(r io.Reader) (io.Reader, error) {
+			return brotli.NewReader(r), nil
+		},
+		Zstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			// Twice, so the second round uses a pooled encoder
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				w, err := NewWriter(&buf, encoding)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := io.WriteString(w, content); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				if buf.Len() >= len(content) {
+					t.Errorf("Expected compressed output smaller than %d bytes, got %d", len(content), buf.Len())
+				}
+
+				r, err := decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(decoded) != content {
+					t.Error("Decoded content does not match original")
+				}
+			}
+		})
+	}
+
+	if _, err := NewWriter(io.Discard, "deflate"); err == nil {
+		t.Error("Expected error for unsupported encoding")
+	}
+}
+
+func TestExtension(t *testing.T) {
+	if Extension(Brotli) != ".br" || Extension(Zstd) != ".zst" || Extension(Gzip) != ".gz" || Extension("identity") != "" {
+		t.Error("Unexpected precompressed extensions")
+	}
+}
@@ -1,40 +1,1022 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/pkg/token"
 )
 
+// Config holds every server option. File keys (YAML or TOML) are the
+// lower-case form of the environment variable, e.g. cache_ttl for CACHE_TTL.
 type Config struct {
-	Port        string
-	BucketName  string
-	TokenSecret string
-	LogLevel    string
-	DocsPath    string
+	Port        string `yaml:"port" toml:"port"`
+	BucketName  string `yaml:"bucket_name" toml:"bucket_name"`
+	TokenSecret string `yaml:"token_secret" toml:"token_secret"`
+	LogLevel    string `yaml:"log_level" toml:"log_level"`
+	DocsPath    string `yaml:"docs_path" toml:"docs_path"`
+	// ObjectPrefix is prepended to object paths, e.g. "acme/" to serve one
+	// folder of the bucket.
+	ObjectPrefix string `yaml:"object_prefix" toml:"object_prefix"`
+
+	// Env is "development" or anything else, e.g. "production", in which
+	// the token secret must be strong. TokenSecretFile holds the secret
+	// instead of TokenSecret, e.g. a mounted Kubernetes or Secret Manager
+	// volume.
+	Env             string `yaml:"app_env" toml:"app_env"`
+	TokenSecretFile string `yaml:"token_secret_file" toml:"token_secret_file"`
+
+	// DirectoryIndex is served for "dir/" paths; empty rejects them.
+	// CleanURLs serves "page" from "page.html".
+	DirectoryIndex string `yaml:"directory_index" toml:"directory_index"`
+	CleanURLs      bool   `yaml:"clean_urls" toml:"clean_urls"`
+
+	// AuthMode selects how document requests are authorized: "token" or "mtls".
+	AuthMode string `yaml:"auth_mode" toml:"auth_mode"`
+
+	// TLS termination. When TLSCertFile and TLSKeyFile are set the server
+	// serves HTTPS itself instead of relying on a fronting proxy.
+	TLSCertFile     string `yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile      string `yaml:"tls_key_file" toml:"tls_key_file"`
+	TLSClientCAFile string `yaml:"tls_client_ca_file" toml:"tls_client_ca_file"`
+	// TLSAllowedClients is separated by ";" since subject DNs contain commas.
+	TLSAllowedClients []string `yaml:"tls_allowed_clients" toml:"tls_allowed_clients"`
+
+	// PolicyFile is an optional YAML/JSON access policy evaluated after
+	// authentication; it is re-read when it changes on disk.
+	PolicyFile           string        `yaml:"policy_file" toml:"policy_file"`
+	PolicyReloadInterval time.Duration `yaml:"policy_reload_interval" toml:"policy_reload_interval"`
+
+	// FrameAncestors lists the CSP sources allowed to embed documents; a
+	// token's origins claim takes precedence.
+	FrameAncestors []string `yaml:"frame_ancestors" toml:"frame_ancestors"`
+
+	// OriginCheckMode is "off", "log" or "enforce" for tokens that carry an
+	// origins claim.
+	OriginCheckMode string `yaml:"origin_check_mode" toml:"origin_check_mode"`
+
+	// ResponseHeaders are added to document and static responses, e.g.
+	// Strict-Transport-Security. RESPONSE_HEADERS takes a JSON object.
+	ResponseHeaders map[string]string `yaml:"response_headers" toml:"response_headers"`
+
+	// HTTP server timeouts; zero disables one. WriteTimeout is off by default
+	// so large documents can reach slow clients. StorageTimeout bounds the
+	// bucket calls of one request.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	StorageTimeout    time.Duration `yaml:"storage_timeout" toml:"storage_timeout"`
+
+	// Token bucket limits; a zero rate disables the limiter.
+	RateLimitIPRate     float64 `yaml:"rate_limit_ip_rps" toml:"rate_limit_ip_rps"`
+	RateLimitIPBurst    int     `yaml:"rate_limit_ip_burst" toml:"rate_limit_ip_burst"`
+	RateLimitTokenRate  float64 `yaml:"rate_limit_token_rps" toml:"rate_limit_token_rps"`
+	RateLimitTokenBurst int     `yaml:"rate_limit_token_burst" toml:"rate_limit_token_burst"`
+	// TrustedProxyHops is the number of proxies in front of the server that
+	// append to X-Forwarded-For; the client address is taken from the entry
+	// the outermost one added. Zero uses the connection address, and is
+	// required when the server terminates TLS itself.
+	TrustedProxyHops int `yaml:"trusted_proxy_hops" toml:"trusted_proxy_hops"`
+
+	// Response compression for text types. PrecompressedLookup prefers
+	// sibling objects such as page.html.br over compressing on the fly.
+	CompressionEnabled  bool `yaml:"compression_enabled" toml:"compression_enabled"`
+	CompressionMinSize  int  `yaml:"compression_min_size" toml:"compression_min_size"`
+	PrecompressedLookup bool `yaml:"precompressed_lookup" toml:"precompressed_lookup"`
+
+	// In-memory object cache; a zero CacheMaxBytes disables it.
+	CacheMaxBytes      int64         `yaml:"cache_max_bytes" toml:"cache_max_bytes"`
+	CacheMaxObjectSize int64         `yaml:"cache_max_object_size" toml:"cache_max_object_size"`
+	CacheTTL           time.Duration `yaml:"cache_ttl" toml:"cache_ttl"`
+	CacheNegativeTTL   time.Duration `yaml:"cache_negative_ttl" toml:"cache_negative_ttl"`
+	// Bucket object whose generation change purges the in-memory cache.
+	CacheManifestObject   string        `yaml:"cache_manifest_object" toml:"cache_manifest_object"`
+	CacheManifestInterval time.Duration `yaml:"cache_manifest_interval" toml:"cache_manifest_interval"`
+
+	// On-disk tier for larger objects; an empty CacheDir disables it.
+	CacheDir              string `yaml:"cache_dir" toml:"cache_dir"`
+	CacheDirMaxBytes      int64  `yaml:"cache_dir_max_bytes" toml:"cache_dir_max_bytes"`
+	CacheDirMaxObjectSize int64  `yaml:"cache_dir_max_object_size" toml:"cache_dir_max_object_size"`
+
+	// Error pages: optional bucket prefix holding <status>.html templates
+	// and a support contact (email or URL) shown to readers.
+	ErrorPagesPrefix string `yaml:"error_pages_prefix" toml:"error_pages_prefix"`
+	SupportContact   string `yaml:"support_contact" toml:"support_contact"`
+
+	// Prometheus metrics served at MetricsPath on the main port. Off by
+	// default since the endpoint is public to anyone who can reach the port.
+	MetricsEnabled bool   `yaml:"metrics_enabled" toml:"metrics_enabled"`
+	MetricsPath    string `yaml:"metrics_path" toml:"metrics_path"`
+
+	// OpenTelemetry tracing: "none", "otlp" or "stdout". The OTLP endpoint
+	// comes from the standard OTEL_EXPORTER_OTLP_ENDPOINT variable.
+	TracingExporter    string  `yaml:"tracing_exporter" toml:"tracing_exporter"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio" toml:"tracing_sample_ratio"`
+
+	// Audit trail of document accesses: "none", "stdout", "file" (AuditFile)
+	// or "bucket" (hourly objects under AuditPrefix in AuditBucket).
+	AuditSink          string        `yaml:"audit_sink" toml:"audit_sink"`
+	AuditFile          string        `yaml:"audit_file" toml:"audit_file"`
+	AuditBucket        string        `yaml:"audit_bucket" toml:"audit_bucket"`
+	AuditPrefix        string        `yaml:"audit_prefix" toml:"audit_prefix"`
+	AuditFlushInterval time.Duration `yaml:"audit_flush_interval" toml:"audit_flush_interval"`
+
+	// Webhook endpoints notified of document views and token events. Bodies
+	// are signed with WebhookSecret.
+	WebhookURLs        []string      `yaml:"webhook_urls" toml:"webhook_urls"`
+	WebhookSecret      string        `yaml:"webhook_secret" toml:"webhook_secret"`
+	WebhookEvents      []string      `yaml:"webhook_events" toml:"webhook_events"`
+	WebhookQueueSize   int           `yaml:"webhook_queue_size" toml:"webhook_queue_size"`
+	WebhookMaxAttempts int           `yaml:"webhook_max_attempts" toml:"webhook_max_attempts"`
+	WebhookTimeout     time.Duration `yaml:"webhook_timeout" toml:"webhook_timeout"`
+
+	// /ready probes ReadyProbeObject (or lists one object when empty) and
+	// reuses results for ReadyCacheTTL.
+	ReadyProbeObject string        `yaml:"ready_probe_object" toml:"ready_probe_object"`
+	ReadyCacheTTL    time.Duration `yaml:"ready_cache_ttl" toml:"ready_cache_ttl"`
+
+	// ConfigReloadInterval is how often the configuration and token secret
+	// files are checked for changes; zero leaves reloading to SIGHUP.
+	ConfigReloadInterval time.Duration `yaml:"config_reload_interval" toml:"config_reload_interval"`
+
+	// Tenants are further sites served by this instance, selected by Host
+	// header or path prefix. Requests matching none use the settings above.
+	// They can only be set in the configuration file.
+	Tenants []Tenant `yaml:"tenants" toml:"tenants"`
+
+	// RoutePrefix is set by Site for path prefix tenants and prepended to
+	// the admin routes. TenantName is set by Site to label audit records and
+	// webhook events.
+	RoutePrefix string `yaml:"-" toml:"-"`
+	TenantName  string `yaml:"-" toml:"-"`
+	// HiddenPrefixes, relative to ObjectPrefix, are folders of this site's
+	// bucket that other sites serve; see NestedPrefixes.
+	HiddenPrefixes []string `yaml:"-" toml:"-"`
 }
 
-func Load() *Config {
+// Tenant overrides the site settings for requests to its hosts or under its
+// path prefix. Empty fields inherit the top-level value.
+type Tenant struct {
+	Name string `yaml:"name" toml:"name"`
+	// Hosts are matched against the Host header without its port. A host
+	// match takes precedence over any path prefix.
+	Hosts []string `yaml:"hosts" toml:"hosts"`
+	// PathPrefix, e.g. "/acme", is prepended to DocsPath.
+	PathPrefix string `yaml:"path_prefix" toml:"path_prefix"`
+
+	BucketName   string `yaml:"bucket_name" toml:"bucket_name"`
+	ObjectPrefix string `yaml:"object_prefix" toml:"object_prefix"`
+	DocsPath     string `yaml:"docs_path" toml:"docs_path"`
+
+	TokenSecret     string `yaml:"token_secret" toml:"token_secret"`
+	TokenSecretFile string `yaml:"token_secret_file" toml:"token_secret_file"`
+	// TLSAllowedClients may read the tenant's documents with auth_mode mtls.
+	// Unlike other settings it is not inherited, so a client certificate
+	// allowed on one site doesn't open every other.
+	TLSAllowedClients []string `yaml:"tls_allowed_clients" toml:"tls_allowed_clients"`
+
+	FrameAncestors   []string          `yaml:"frame_ancestors" toml:"frame_ancestors"`
+	ResponseHeaders  map[string]string `yaml:"response_headers" toml:"response_headers"`
+	ErrorPagesPrefix string            `yaml:"error_pages_prefix" toml:"error_pages_prefix"`
+	SupportContact   string            `yaml:"support_contact" toml:"support_contact"`
+}
+
+// Site returns the configuration for serving tenant t: a copy of c with the
+// tenant's overrides applied and no tenants of its own.
+func (c *Config) Site(t Tenant) *Config {
+	site := *c
+	site.Tenants = nil
+	if t.BucketName != "" {
+		site.BucketName = t.BucketName
+	}
+	if t.ObjectPrefix != "" {
+		site.ObjectPrefix = t.ObjectPrefix
+	}
+	if t.DocsPath != "" {
+		site.DocsPath = t.DocsPath
+	}
+	site.DocsPath = t.PathPrefix + site.DocsPath
+	site.RoutePrefix = t.PathPrefix
+	site.TenantName = t.Name
+	if t.TokenSecret != "" {
+		site.TokenSecret = t.TokenSecret
+		site.TokenSecretFile = ""
+	}
+	site.TLSAllowedClients = t.TLSAllowedClients
+	if t.FrameAncestors != nil {
+		site.FrameAncestors = t.FrameAncestors
+	}
+	if t.ResponseHeaders != nil {
+		site.ResponseHeaders = t.ResponseHeaders
+	}
+	if t.ErrorPagesPrefix != "" {
+		site.ErrorPagesPrefix = t.ErrorPagesPrefix
+	}
+	if t.SupportContact != "" {
+		site.SupportContact = t.SupportContact
+	}
+	site.HiddenPrefixes = c.NestedPrefixes(site.BucketName, site.ObjectPrefix)
+	return &site
+}
+
+// NestedPrefixes returns the object prefixes, relative to prefix, that the
+// top-level site or a tenant serves from inside prefix of bucket. The site
+// serving bucket and prefix must not serve them, or its tokens would open
+// the other site's documents.
+func (c *Config) NestedPrefixes(bucket, prefix string) []string {
+	var nested []string
+	add := func(siteBucket, sitePrefix string) {
+		if siteBucket == bucket && len(sitePrefix) > len(prefix) && strings.HasPrefix(sitePrefix, prefix) {
+			nested = append(nested, strings.TrimPrefix(sitePrefix, prefix))
+		}
+	}
+	add(c.BucketName, c.ObjectPrefix)
+	for _, t := range c.Tenants {
+		siteBucket, sitePrefix := c.BucketName, c.ObjectPrefix
+		if t.BucketName != "" {
+			siteBucket = t.BucketName
+		}
+		if t.ObjectPrefix != "" {
+			sitePrefix = t.ObjectPrefix
+		}
+		add(siteBucket, sitePrefix)
+	}
+	return nested
+}
+
+const (
+	AuthModeToken = "token"
+	AuthModeMTLS  = "mtls"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// DefaultTokenSecret is only accepted in development.
+	DefaultTokenSecret = "default-secret-change-in-production"
+
+	// Secrets outside development need at least this many bytes, each
+	// carrying this many bits of estimated entropy. Random hex passes;
+	// repeated words and characters don't.
+	minSecretLength      = 32
+	minSecretBitsPerByte = 3.0
+)
+
+// Default returns the built-in configuration, before any file, environment
+// variable or override is applied.
+func Default() *Config {
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		BucketName:  getEnv("BUCKET_NAME", ""),
-		TokenSecret: getEnv("TOKEN_SECRET", "default-secret-change-in-production"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-		DocsPath:    getEnv("DOCS_PATH", "/docs"),
+		Port:        "8080",
+		TokenSecret: DefaultTokenSecret,
+		LogLevel:    "info",
+		DocsPath:    "/docs",
+
+		Env: EnvDevelopment,
+
+		DirectoryIndex: "index.html",
+
+		AuthMode: AuthModeToken,
+
+		PolicyReloadInterval: 30 * time.Second,
+
+		FrameAncestors: []string{"'self'"},
+
+		OriginCheckMode: "log",
+
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   30 * time.Second,
+		StorageTimeout:    30 * time.Second,
+
+		RateLimitIPRate:     50,
+		RateLimitIPBurst:    300,
+		RateLimitTokenRate:  20,
+		RateLimitTokenBurst: 200,
+		TrustedProxyHops:    1,
+
+		CompressionEnabled:  true,
+		CompressionMinSize:  1024,
+		PrecompressedLookup: true,
+
+		CacheMaxBytes:      64 << 20,
+		CacheMaxObjectSize: 1 << 20,
+		CacheTTL:           5 * time.Minute,
+		CacheNegativeTTL:   30 * time.Second,
+
+		CacheManifestInterval: time.Minute,
+
+		CacheDirMaxBytes:      1 << 30,
+		CacheDirMaxObjectSize: 100 << 20,
+
+		MetricsPath: "/metrics",
+
+		TracingExporter:    "none",
+		TracingSampleRatio: 1.0,
+
+		AuditSink:          "none",
+		AuditPrefix:        "audit/",
+		AuditFlushInterval: time.Minute,
+
+		WebhookQueueSize:   1000,
+		WebhookMaxAttempts: 5,
+		WebhookTimeout:     5 * time.Second,
+
+		ReadyCacheTTL: 10 * time.Second,
+
+		ConfigReloadInterval: 30 * time.Second,
+	}
+}
+
+// Load returns the defaults overridden by environment variables. Invalid
+// values are ignored; the server uses Parse, which reports them.
+func Load() *Config {
+	cfg := Default()
+	cfg.applyEnv(os.LookupEnv)
+	return cfg
+}
+
+// Parse builds the server configuration from, in increasing precedence, the
+// defaults, the YAML or TOML file at path (if any), environment variables and
+// "key=value" overrides, then validates it. All problems are reported
+// together; the returned Config is always usable, e.g. to set up logging.
+func Parse(path string, overrides []string) (*Config, error) {
+	cfg := Default()
+	var errs []error
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		errs = append(errs, err)
+	}
+	for _, override := range overrides {
+		if err := cfg.Set(override); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := cfg.ResolveTokenSecret(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
 	}
+	return cfg, errors.Join(errs...)
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// loadFile decodes a YAML (.yaml, .yml, .json) or TOML (.toml) file over the
+// current values. Unknown keys are errors so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
-	return defaultValue
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("config file %s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format, expected .yaml, .yml, .json or .toml", path)
+	}
+	return nil
+}
+
+// Set applies one "key=value" override using the file keys, e.g.
+// "cache_ttl=10m" or "webhook_urls=[https://a.example, https://b.example]".
+// The value is parsed as YAML.
+func (c *Config) Set(assignment string) error {
+	key, value, ok := strings.Cut(assignment, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("invalid override %q: expected key=value", assignment)
+	}
+
+	valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"}
+	if value != "" {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &doc); err != nil {
+			return fmt.Errorf("override %s: %w", key, err)
+		}
+		valueNode = doc.Content[0]
+	}
+	data, err := yaml.Marshal(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: key}, valueNode,
+	}})
+	if err != nil {
+		return fmt.Errorf("override %s: %w", key, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("override %s: %w", key, err)
+	}
+	return nil
+}
+
+// applyEnv overrides values from environment variables. Empty variables are
+// treated as unset.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	e := &envLoader{lookup: lookup}
+
+	e.str(&c.Port, "PORT")
+	e.str(&c.BucketName, "BUCKET_NAME")
+	e.str(&c.TokenSecret, "TOKEN_SECRET")
+	e.str(&c.LogLevel, "LOG_LEVEL")
+	e.str(&c.DocsPath, "DOCS_PATH")
+	e.str(&c.ObjectPrefix, "OBJECT_PREFIX")
+
+	e.str(&c.Env, "APP_ENV")
+	e.str(&c.TokenSecretFile, "TOKEN_SECRET_FILE")
+
+	e.str(&c.DirectoryIndex, "DIRECTORY_INDEX")
+	e.bool(&c.CleanURLs, "CLEAN_URLS")
+
+	e.str(&c.AuthMode, "AUTH_MODE")
+
+	e.str(&c.TLSCertFile, "TLS_CERT_FILE")
+	e.str(&c.TLSKeyFile, "TLS_KEY_FILE")
+	e.str(&c.TLSClientCAFile, "TLS_CLIENT_CA_FILE")
+	e.list(&c.TLSAllowedClients, "TLS_ALLOWED_CLIENTS", ";")
+
+	e.str(&c.PolicyFile, "POLICY_FILE")
+	e.duration(&c.PolicyReloadInterval, "POLICY_RELOAD_INTERVAL")
+
+	e.list(&c.FrameAncestors, "FRAME_ANCESTORS", ",")
+
+	e.str(&c.OriginCheckMode, "ORIGIN_CHECK_MODE")
+
+	e.headers(&c.ResponseHeaders, "RESPONSE_HEADERS")
+
+	e.duration(&c.ReadHeaderTimeout, "READ_HEADER_TIMEOUT")
+	e.duration(&c.ReadTimeout, "READ_TIMEOUT")
+	e.duration(&c.WriteTimeout, "WRITE_TIMEOUT")
+	e.duration(&c.IdleTimeout, "IDLE_TIMEOUT")
+	e.duration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+	e.duration(&c.StorageTimeout, "STORAGE_TIMEOUT")
+
+	e.float(&c.RateLimitIPRate, "RATE_LIMIT_IP_RPS")
+	e.int(&c.RateLimitIPBurst, "RATE_LIMIT_IP_BURST")
+	e.float(&c.RateLimitTokenRate, "RATE_LIMIT_TOKEN_RPS")
+	e.int(&c.RateLimitTokenBurst, "RATE_LIMIT_TOKEN_BURST")
+	e.int(&c.TrustedProxyHops, "TRUSTED_PROXY_HOPS")
+
+	e.bool(&c.CompressionEnabled, "COMPRESSION_ENABLED")
+	e.int(&c.CompressionMinSize, "COMPRESSION_MIN_SIZE")
+	e.bool(&c.PrecompressedLookup, "PRECOMPRESSED_LOOKUP")
+
+	e.int64(&c.CacheMaxBytes, "CACHE_MAX_BYTES")
+	e.int64(&c.CacheMaxObjectSize, "CACHE_MAX_OBJECT_SIZE")
+	e.duration(&c.CacheTTL, "CACHE_TTL")
+	e.duration(&c.CacheNegativeTTL, "CACHE_NEGATIVE_TTL")
+
+	e.str(&c.CacheManifestObject, "CACHE_MANIFEST_OBJECT")
+	e.duration(&c.CacheManifestInterval, "CACHE_MANIFEST_INTERVAL")
+
+	e.str(&c.CacheDir, "CACHE_DIR")
+	e.int64(&c.CacheDirMaxBytes, "CACHE_DIR_MAX_BYTES")
+	e.int64(&c.CacheDirMaxObjectSize, "CACHE_DIR_MAX_OBJECT_SIZE")
+
+	e.str(&c.ErrorPagesPrefix, "ERROR_PAGES_PREFIX")
+	e.str(&c.SupportContact, "SUPPORT_CONTACT")
+
+	e.bool(&c.MetricsEnabled, "METRICS_ENABLED")
+	e.str(&c.MetricsPath, "METRICS_PATH")
+
+	e.str(&c.TracingExporter, "TRACING_EXPORTER")
+	e.float(&c.TracingSampleRatio, "TRACING_SAMPLE_RATIO")
+
+	e.str(&c.AuditSink, "AUDIT_SINK")
+	e.str(&c.AuditFile, "AUDIT_FILE")
+	e.str(&c.AuditBucket, "AUDIT_BUCKET")
+	e.str(&c.AuditPrefix, "AUDIT_PREFIX")
+	e.duration(&c.AuditFlushInterval, "AUDIT_FLUSH_INTERVAL")
+
+	e.list(&c.WebhookURLs, "WEBHOOK_URLS", ",")
+	e.str(&c.WebhookSecret, "WEBHOOK_SECRET")
+	e.list(&c.WebhookEvents, "WEBHOOK_EVENTS", ",")
+	e.int(&c.WebhookQueueSize, "WEBHOOK_QUEUE_SIZE")
+	e.int(&c.WebhookMaxAttempts, "WEBHOOK_MAX_ATTEMPTS")
+	e.duration(&c.WebhookTimeout, "WEBHOOK_TIMEOUT")
+
+	e.str(&c.ReadyProbeObject, "READY_PROBE_OBJECT")
+	e.duration(&c.ReadyCacheTTL, "READY_CACHE_TTL")
+
+	e.duration(&c.ConfigReloadInterval, "CONFIG_RELOAD_INTERVAL")
+
+	return errors.Join(e.errs...)
 }
 
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.ParseBool(value); err == nil {
-			return parsed
+// ResolveTokenSecret reads TokenSecretFile, if set, into TokenSecret. Outside
+// development it then rejects the default secret and short or guessable
+// ones, so a forgotten variable can't leave tokens forgeable.
+func (c *Config) ResolveTokenSecret() error {
+	if c.TokenSecretFile != "" {
+		if c.TokenSecret != DefaultTokenSecret {
+			return errors.New("token_secret: set either token_secret or token_secret_file, not both")
+		}
+		secret, err := readSecretFile(c.TokenSecretFile)
+		if err != nil {
+			return err
+		}
+		c.TokenSecret = secret
+	}
+
+	var errs []error
+	if c.Env != EnvDevelopment {
+		errs = append(errs, checkSecretStrength(c.TokenSecret))
+	}
+	for i := range c.Tenants {
+		t := &c.Tenants[i]
+		if t.TokenSecretFile != "" {
+			if t.TokenSecret != "" {
+				errs = append(errs, fmt.Errorf("tenants[%s]: set either token_secret or token_secret_file, not both", t.Name))
+				continue
+			}
+			secret, err := readSecretFile(t.TokenSecretFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%s]: %w", t.Name, err))
+				continue
+			}
+			t.TokenSecret = secret
+		}
+		if c.Env == EnvDevelopment {
+			continue
+		}
+		// A shared secret would let one customer's tokens open another's documents
+		if c.servesOtherDocuments(*t) && (t.TokenSecret == "" || t.TokenSecret == c.TokenSecret) {
+			errs = append(errs, fmt.Errorf("tenants[%s]: token_secret: a secret of its own is required outside development when bucket_name or object_prefix differs from the top level", t.Name))
+			continue
+		}
+		if t.TokenSecret != "" {
+			if err := checkSecretStrength(t.TokenSecret); err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%s]: %w", t.Name, err))
+			}
 		}
 	}
-	return defaultValue
-}
\ No newline at end of file
+	return errors.Join(errs...)
+}
+
+// servesOtherDocuments reports whether tenant t reads objects the top-level
+// site does not.
+func (c *Config) servesOtherDocuments(t Tenant) bool {
+	return (t.BucketName != "" && t.BucketName != c.BucketName) ||
+		(t.ObjectPrefix != "" && t.ObjectPrefix != c.ObjectPrefix)
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("token_secret_file: %w", err)
+	}
+	// Files written by echo or editors end with a newline
+	secret := strings.TrimRight(string(data), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("token_secret_file: %s is empty", path)
+	}
+	return secret, nil
+}
+
+// IsDefaultTokenSecret reports whether the built-in development secret is
+// in use.
+func (c *Config) IsDefaultTokenSecret() bool {
+	return c.TokenSecret == DefaultTokenSecret
+}
+
+func checkSecretStrength(secret string) error {
+	switch {
+	case secret == DefaultTokenSecret:
+		return errors.New("token_secret: the default secret is not allowed outside development; generate one with: openssl rand -base64 32")
+	case len(secret) < minSecretLength:
+		return fmt.Errorf("token_secret: %d bytes is too short outside development, need at least %d", len(secret), minSecretLength)
+	case secretEntropy(secret) < minSecretBitsPerByte:
+		return errors.New("token_secret: too predictable outside development, use a random value such as: openssl rand -base64 32")
+	}
+	return nil
+}
+
+// secretEntropy estimates the bits of entropy per byte of secret from the
+// frequency of its bytes. It catches repetition, not every weak secret.
+func secretEntropy(secret string) float64 {
+	counts := map[byte]int{}
+	for i := 0; i < len(secret); i++ {
+		counts[secret[i]]++
+	}
+	var bits float64
+	for _, count := range counts {
+		p := float64(count) / float64(len(secret))
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+// TLSEnabled reports whether the server should terminate TLS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Validate checks the whole configuration and reports every problem, not
+// just the first.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("port: %q is not a valid port number", c.Port)
+	}
+	if !strings.HasPrefix(c.DocsPath, "/") || (len(c.DocsPath) > 1 && strings.HasSuffix(c.DocsPath, "/")) {
+		fail("docs_path: %q must start with / and have no trailing slash", c.DocsPath)
+	}
+	if !validObjectPrefix(c.ObjectPrefix) {
+		fail("object_prefix: %q must end with / and not start with one", c.ObjectPrefix)
+	}
+	if c.MetricsEnabled && !strings.HasPrefix(c.MetricsPath, "/") {
+		fail("metrics_path: %q must start with /", c.MetricsPath)
+	}
+
+	oneOf := func(key, value string, allowed ...string) {
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		fail("%s: %q must be one of %s", key, value, strings.Join(allowed, ", "))
+	}
+	oneOf("tracing_exporter", c.TracingExporter, "none", "otlp", "stdout")
+	oneOf("audit_sink", c.AuditSink, "none", "stdout", "file", "bucket")
+	oneOf("origin_check_mode", strings.ToLower(c.OriginCheckMode), "off", "log", "enforce")
+	oneOf("auth_mode", c.AuthMode, AuthModeToken, AuthModeMTLS)
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		fail("log_level: %q must be one of debug, info, warn, error, critical", c.LogLevel)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		fail("tls_cert_file and tls_key_file must be set together")
+	}
+	// Without a proxy in front, X-Forwarded-For is whatever the client sends
+	if c.TLSEnabled() && c.TrustedProxyHops > 0 {
+		fail("trusted_proxy_hops: must be 0 when the server terminates TLS itself, since no proxy adds X-Forwarded-For")
+	}
+	// mTLS without a CA or allow list would leave documents unreachable
+	if c.AuthMode == AuthModeMTLS {
+		if !c.TLSEnabled() {
+			fail("auth_mode: mtls requires tls_cert_file and tls_key_file")
+		}
+		if c.TLSClientCAFile == "" {
+			fail("auth_mode: mtls requires tls_client_ca_file")
+		}
+		if len(c.TLSAllowedClients) == 0 {
+			fail("auth_mode: mtls requires tls_allowed_clients")
+		}
+	}
+	if c.AuditSink == "file" && c.AuditFile == "" {
+		fail("audit_file: required when audit_sink is file")
+	}
+	if c.AuditSink == "bucket" {
+		switch c.AuditBucket {
+		case "":
+			fail("audit_bucket: required when audit_sink is bucket")
+		case c.BucketName:
+			// Anything in the docs bucket can be fetched through docs_path
+			fail("audit_bucket: must differ from bucket_name, which is served to readers")
+		default:
+			for _, t := range c.Tenants {
+				if t.BucketName == c.AuditBucket {
+					fail("audit_bucket: must differ from the bucket_name of tenants[%s], which is served to readers", t.Name)
+				}
+			}
+		}
+		if c.AuditFlushInterval <= 0 {
+			fail("audit_flush_interval: must be positive when audit_sink is bucket")
+		}
+	}
+	for _, u := range c.WebhookURLs {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fail("webhook_urls: %q is not an http(s) URL", u)
+		}
+	}
+	if len(c.WebhookURLs) > 0 && c.WebhookSecret == "" {
+		fail("webhook_secret: required to sign deliveries to webhook_urls")
+	}
+	for _, event := range c.WebhookEvents {
+		if !slices.Contains(webhookEvents, event) {
+			fail("webhook_events: %q must be one of %s", event, strings.Join(webhookEvents, ", "))
+		}
+	}
+
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		fail("tracing_sample_ratio: %v must be between 0 and 1", c.TracingSampleRatio)
+	}
+	for key, value := range map[string]float64{
+		"rate_limit_ip_rps":    c.RateLimitIPRate,
+		"rate_limit_token_rps": c.RateLimitTokenRate,
+	} {
+		if value < 0 {
+			fail("%s: %v must not be negative", key, value)
+		}
+	}
+	for key, value := range map[string]int64{
+		"rate_limit_ip_burst":       int64(c.RateLimitIPBurst),
+		"rate_limit_token_burst":    int64(c.RateLimitTokenBurst),
+		"trusted_proxy_hops":        int64(c.TrustedProxyHops),
+		"compression_min_size":      int64(c.CompressionMinSize),
+		"cache_max_bytes":           c.CacheMaxBytes,
+		"cache_max_object_size":     c.CacheMaxObjectSize,
+		"cache_dir_max_bytes":       c.CacheDirMaxBytes,
+		"cache_dir_max_object_size": c.CacheDirMaxObjectSize,
+		"webhook_queue_size":        int64(c.WebhookQueueSize),
+		"webhook_max_attempts":      int64(c.WebhookMaxAttempts),
+	} {
+		if value < 0 {
+			fail("%s: %d must not be negative", key, value)
+		}
+	}
+	for key, value := range map[string]time.Duration{
+		"policy_reload_interval":  c.PolicyReloadInterval,
+		"read_header_timeout":     c.ReadHeaderTimeout,
+		"read_timeout":            c.ReadTimeout,
+		"write_timeout":           c.WriteTimeout,
+		"idle_timeout":            c.IdleTimeout,
+		"shutdown_timeout":        c.ShutdownTimeout,
+		"storage_timeout":         c.StorageTimeout,
+		"cache_ttl":               c.CacheTTL,
+		"cache_negative_ttl":      c.CacheNegativeTTL,
+		"cache_manifest_interval": c.CacheManifestInterval,
+		"audit_flush_interval":    c.AuditFlushInterval,
+		"webhook_timeout":         c.WebhookTimeout,
+		"ready_cache_ttl":         c.ReadyCacheTTL,
+		"config_reload_interval":  c.ConfigReloadInterval,
+	} {
+		if value < 0 {
+			fail("%s: %s must not be negative", key, value)
+		}
+	}
+
+	errs = append(errs, checkHeaders("response_headers", c.ResponseHeaders)...)
+	errs = append(errs, checkFrameAncestors("frame_ancestors", c.FrameAncestors)...)
+	errs = append(errs, c.validateTenants()...)
+
+	sortErrors(errs)
+	return errors.Join(errs...)
+}
+
+// webhookEvents are the event types internal/webhook delivers.
+var webhookEvents = []string{"document.viewed", "token.first_used", "token.expired", "token.rejected"}
+
+func checkFrameAncestors(key string, sources []string) []error {
+	var errs []error
+	for _, source := range sources {
+		if !validFrameSource(source) {
+			errs = append(errs, fmt.Errorf("%s: %q must be 'self', 'none' or scheme://host[:port]", key, source))
+		}
+	}
+	return errs
+}
+
+func validFrameSource(source string) bool {
+	switch source {
+	case "'self'", "'none'", "*", "https:", "http:":
+		return true
+	}
+	return token.ValidOrigin(source)
+}
+
+func checkHeaders(key string, headers map[string]string) []error {
+	var errs []error
+	for name, value := range headers {
+		if !validHeaderName(name) {
+			errs = append(errs, fmt.Errorf("%s: %q is not a valid header name", key, name))
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			errs = append(errs, fmt.Errorf("%s: value of %s contains a line break", key, name))
+		}
+	}
+	return errs
+}
+
+// validateTenants checks that every tenant can be told apart from the others
+// and from the top-level site.
+func (c *Config) validateTenants() []error {
+	var errs []error
+	names := map[string]bool{}
+	hosts := map[string]string{}
+	prefixes := map[string]string{}
+	for i, t := range c.Tenants {
+		key := fmt.Sprintf("tenants[%d]", i)
+		if t.Name != "" {
+			key = "tenants[" + t.Name + "]"
+		}
+		fail := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf(key+": "+format, args...))
+		}
+
+		switch {
+		case t.Name == "":
+			fail("name is required")
+		case names[t.Name]:
+			fail("duplicate name")
+		}
+		names[t.Name] = true
+
+		if len(t.Hosts) == 0 && t.PathPrefix == "" {
+			fail("set hosts or path_prefix")
+		}
+		for _, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if host == "" || strings.ContainsAny(host, "/: ") {
+				fail("host %q must be a bare host name", host)
+			} else if other, ok := hosts[host]; ok {
+				fail("host %s is also used by %s", host, other)
+			}
+			hosts[host] = t.Name
+		}
+		if t.PathPrefix != "" {
+			if !strings.HasPrefix(t.PathPrefix, "/") || strings.HasSuffix(t.PathPrefix, "/") {
+				fail("path_prefix %q must start with / and have no trailing slash", t.PathPrefix)
+			} else if other, ok := prefixes[t.PathPrefix]; ok {
+				fail("path_prefix %s is also used by %s", t.PathPrefix, other)
+			}
+			prefixes[t.PathPrefix] = t.Name
+		}
+		if t.DocsPath != "" && (!strings.HasPrefix(t.DocsPath, "/") || strings.HasSuffix(t.DocsPath, "/")) {
+			fail("docs_path %q must start with / and have no trailing slash", t.DocsPath)
+		}
+		if !validObjectPrefix(t.ObjectPrefix) {
+			fail("object_prefix %q must end with / and not start with one", t.ObjectPrefix)
+		}
+		if t.BucketName == "" && c.BucketName == "" {
+			fail("bucket_name is required when no top-level bucket_name is set")
+		}
+		if c.AuthMode == AuthModeMTLS && len(t.TLSAllowedClients) == 0 {
+			fail("tls_allowed_clients: required with auth_mode mtls, the top-level list is not inherited")
+		}
+		errs = append(errs, checkHeaders(key+".response_headers", t.ResponseHeaders)...)
+		errs = append(errs, checkFrameAncestors(key+".frame_ancestors", t.FrameAncestors)...)
+	}
+	return errs
+}
+
+func validObjectPrefix(prefix string) bool {
+	return prefix == "" || (!strings.HasPrefix(prefix, "/") && strings.HasSuffix(prefix, "/"))
+}
+
+// validHeaderName reports whether name is an RFC 9110 token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortErrors orders messages so map iteration doesn't shuffle the report.
+func sortErrors(errs []error) {
+	slices.SortStableFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+}
+
+// envLoader reads typed variables, collecting parse errors instead of
+// silently keeping the previous value.
+type envLoader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+func (e *envLoader) value(key string) (string, bool) {
+	value, ok := e.lookup(key)
+	return value, ok && value != ""
+}
+
+func (e *envLoader) fail(key, value, kind string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: invalid %s %q", key, kind, value))
+}
+
+func (e *envLoader) str(dst *string, key string) {
+	if value, ok := e.value(key); ok {
+		*dst = value
+	}
+}
+
+func (e *envLoader) bool(dst *bool, key string) {
+	if value, ok := e.value(key); ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, "boolean")
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envLoader) int(dst *int, key string) {
+	if value, ok := e.value(key); ok {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, "integer")
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envLoader) int64(dst *int64, key string) {
+	if value, ok := e.value(key); ok {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.fail(key, value, "integer")
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envLoader) float(dst *float64, key string) {
+	if value, ok := e.value(key); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.fail(key, value, "number")
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envLoader) duration(dst *time.Duration, key string) {
+	if value, ok := e.value(key); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, "duration")
+			return
+		}
+		*dst = parsed
+	}
+}
+
+func (e *envLoader) list(dst *[]string, key, sep string) {
+	if value, ok := e.value(key); ok {
+		*dst = splitList(value, sep)
+	}
+}
+
+func (e *envLoader) headers(dst *map[string]string, key string) {
+	if value, ok := e.value(key); ok {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(value), &headers); err != nil {
+			e.fail(key, value, "JSON object")
+			return
+		}
+		*dst = headers
+	}
+}
+
+func splitList(value, sep string) []string {
+	var list []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
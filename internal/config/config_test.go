@@ -2,7 +2,11 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -20,23 +24,30 @@ func TestLoad(t *testing.T) {
 				TokenSecret: "default-secret-change-in-production",
 				LogLevel:    "info",
 				DocsPath:    "/docs",
+				AuthMode:    "token",
+				// /metrics is unauthenticated, so it must be opted into
+				MetricsEnabled: false,
 			},
 		},
 		{
 			name: "custom values",
 			envVars: map[string]string{
-				"PORT":         "9000",
-				"BUCKET_NAME":  "test-bucket",
-				"TOKEN_SECRET": "test-secret",
-				"LOG_LEVEL":    "debug",
-				"DOCS_PATH":    "/documents",
+				"PORT":            "9000",
+				"BUCKET_NAME":     "test-bucket",
+				"TOKEN_SECRET":    "test-secret",
+				"LOG_LEVEL":       "debug",
+				"DOCS_PATH":       "/documents",
+				"AUTH_MODE":       "mtls",
+				"METRICS_ENABLED": "true",
 			},
 			expected: Config{
-				Port:        "9000",
-				BucketName:  "test-bucket",
-				TokenSecret: "test-secret",
-				LogLevel:    "debug",
-				DocsPath:    "/documents",
+				Port:           "9000",
+				BucketName:     "test-bucket",
+				TokenSecret:    "test-secret",
+				LogLevel:       "debug",
+				DocsPath:       "/documents",
+				AuthMode:       "mtls",
+				MetricsEnabled: true,
 			},
 		},
 	}
@@ -69,6 +80,410 @@ func TestLoad(t *testing.T) {
 			if cfg.DocsPath != tt.expected.DocsPath {
 				t.Errorf("DocsPath = %v, want %v", cfg.DocsPath, tt.expected.DocsPath)
 			}
+			if cfg.AuthMode != tt.expected.AuthMode {
+				t.Errorf("AuthMode = %v, want %v", cfg.AuthMode, tt.expected.AuthMode)
+			}
+			if cfg.MetricsEnabled != tt.expected.MetricsEnabled {
+				t.Errorf("MetricsEnabled = %v, want %v", cfg.MetricsEnabled, tt.expected.MetricsEnabled)
+			}
+		})
+	}
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "config.yaml", `
+port: "9000"
+bucket_name: course-docs
+cache_ttl: 10m
+frame_ancestors: ["'self'", "https://lms.example.com"]
+response_headers:
+  Strict-Transport-Security: max-age=31536000
+`},
+		{"toml", "config.toml", `
+port = "9000"
+bucket_name = "course-docs"
+cache_ttl = "10m"
+frame_ancestors = ["'self'", "https://lms.example.com"]
+
+[response_headers]
+Strict-Transport-Security = "max-age=31536000"
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(writeConfigFile(t, tt.file, tt.content), nil)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if cfg.Port != "9000" || cfg.BucketName != "course-docs" || cfg.CacheTTL != 10*time.Minute {
+				t.Errorf("Unexpected config %+v", cfg)
+			}
+			if len(cfg.FrameAncestors) != 2 || cfg.FrameAncestors[1] != "https://lms.example.com" {
+				t.Errorf("FrameAncestors = %v", cfg.FrameAncestors)
+			}
+			if cfg.ResponseHeaders["Strict-Transport-Security"] != "max-age=31536000" {
+				t.Errorf("ResponseHeaders = %v", cfg.ResponseHeaders)
+			}
+			// Unset keys keep their defaults
+			if cfg.DocsPath != "/docs" || cfg.ReadHeaderTimeout != 10*time.Second {
+				t.Errorf("Expected defaults for unset keys, got %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestParseUnknownKeys(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		sep := ": "
+		if strings.HasSuffix(name, ".toml") {
+			sep = " = "
+		}
+		path := writeConfigFile(t, name, "cache_tll"+sep+"\"10m\"\n")
+		if _, err := Parse(path, nil); err == nil || !strings.Contains(err.Error(), "cache_tll") {
+			t.Errorf("%s: expected error naming the unknown key, got %v", name, err)
+		}
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "port: \"9000\"\nlog_level: debug\ncache_ttl: 10m\n")
+	t.Setenv("PORT", "9100")
+	t.Setenv("CACHE_TTL", "")
+
+	cfg, err := Parse(path, []string{"port=9200", "clean_urls=true"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.Port != "9200" {
+		t.Errorf("Expected --set to win over the environment, got port %s", cfg.Port)
+	}
+	if cfg.LogLevel != "debug" || cfg.CacheTTL != 10*time.Minute {
+		t.Errorf("Expected file values where nothing overrides them, got %+v", cfg)
+	}
+	if !cfg.CleanURLs {
+		t.Error("Expected clean_urls override to apply")
+	}
+}
+
+func TestParseReportsAllErrors(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "port: \"99999\"\ndocs_path: docs/\n")
+	t.Setenv("CACHE_TTL", "soon")
+
+	_, err := Parse(path, []string{"audit_sink=syslog", "bogus"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, want := range []string{"port", "docs_path", "CACHE_TTL", "audit_sink", "bogus"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"tls key without cert", func(c *Config) { c.TLSKeyFile = "server.key" }, "tls_cert_file"},
+		{"sample ratio", func(c *Config) { c.TracingSampleRatio = 1.5 }, "tracing_sample_ratio"},
+		{"negative timeout", func(c *Config) { c.ReadTimeout = -time.Second }, "read_timeout"},
+		{"negative cache size", func(c *Config) { c.CacheMaxBytes = -1 }, "cache_max_bytes"},
+		{"header name", func(c *Config) { c.ResponseHeaders = map[string]string{"Bad Header": "x"} }, "Bad Header"},
+		{"header injection", func(c *Config) { c.ResponseHeaders = map[string]string{"X-A": "a\r\nX-B: b"} }, "line break"},
+		{"webhook url", func(c *Config) { c.WebhookURLs = []string{"ftp://hooks.example.com"}; c.WebhookSecret = "s" }, "webhook_urls"},
+		{"webhook secret", func(c *Config) { c.WebhookURLs = []string{"https://hooks.example.com"} }, "webhook_secret"},
+		{"webhook event", func(c *Config) { c.WebhookEvents = []string{"document.opened"} }, "webhook_events"},
+		{"log level", func(c *Config) { c.LogLevel = "verbose" }, "log_level"},
+		{"origin check mode", func(c *Config) { c.OriginCheckMode = "strict" }, "origin_check_mode"},
+		{"origin check mode case", func(c *Config) { c.OriginCheckMode = "Enforce" }, ""},
+		{"unknown auth mode", func(c *Config) { c.AuthMode = "basic" }, "auth_mode"},
+		{"mtls without TLS", func(c *Config) {
+			c.AuthMode, c.TLSClientCAFile, c.TLSAllowedClients = AuthModeMTLS, "ca.pem", []string{"portal"}
+		}, "requires tls_cert_file"},
+		{"mtls without client CA", func(c *Config) {
+			c.AuthMode, c.TLSCertFile, c.TLSKeyFile, c.TLSAllowedClients = AuthModeMTLS, "cert.pem", "key.pem", []string{"portal"}
+		}, "tls_client_ca_file"},
+		{"mtls without allow-list", func(c *Config) {
+			c.AuthMode, c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile = AuthModeMTLS, "cert.pem", "key.pem", "ca.pem"
+		}, "tls_allowed_clients"},
+		{"mtls complete", func(c *Config) {
+			c.AuthMode, c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile, c.TLSAllowedClients = AuthModeMTLS, "cert.pem", "key.pem", "ca.pem", []string{"portal"}
+			c.TrustedProxyHops = 0
+		}, ""},
+		{"proxy hops with direct TLS", func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "cert.pem", "key.pem" }, "trusted_proxy_hops"},
+		{"no proxy hops with direct TLS", func(c *Config) { c.TLSCertFile, c.TLSKeyFile, c.TrustedProxyHops = "cert.pem", "key.pem", 0 }, ""},
+		{"frame ancestors", func(c *Config) { c.FrameAncestors = []string{"'self'", "https://*.lms.example.com"} }, ""},
+		{"frame ancestors list in one entry", func(c *Config) { c.FrameAncestors = []string{"'self' https://lms.example.com"} }, "frame_ancestors"},
+		{"frame ancestors bare host", func(c *Config) { c.FrameAncestors = []string{"lms.example.com"} }, "frame_ancestors"},
+		{"frame ancestors keyword", func(c *Config) { c.FrameAncestors = []string{"'unsafe-inline'"} }, "frame_ancestors"},
+		{"audit file without path", func(c *Config) { c.AuditSink = "file" }, "audit_file"},
+		{"audit bucket without name", func(c *Config) { c.AuditSink = "bucket" }, "audit_bucket: required"},
+		{"audit docs bucket", func(c *Config) { c.AuditSink, c.AuditBucket, c.BucketName = "bucket", "docs", "docs" }, "must differ from bucket_name"},
+		{"audit tenant bucket", func(c *Config) {
+			c.AuditSink, c.AuditBucket = "bucket", "audit"
+			c.Tenants = []Tenant{{Name: "acme", Hosts: []string{"acme.example"}, BucketName: "audit"}}
+		}, "tenants[acme], which is served"},
+		{"audit flush interval", func(c *Config) { c.AuditSink, c.AuditBucket, c.AuditFlushInterval = "bucket", "audit", 0 }, "audit_flush_interval"},
+		{"audit sink", func(c *Config) { c.AuditSink = "syslog" }, "audit_sink"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want mention of %s", err, tt.wantErr)
+			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestResolveTokenSecret(t *testing.T) {
+	strong := "q8Vx2mT9LpZr4KcW7nYb3HdJ6sFg1AeU"
+	secretFile := writeConfigFile(t, "token-secret", strong+"\n")
+
+	tests := []struct {
+		name       string
+		env        string
+		secret     string
+		secretFile string
+		want       string
+		wantErr    bool
+	}{
+		{"default allowed in development", EnvDevelopment, DefaultTokenSecret, "", DefaultTokenSecret, false},
+		{"default rejected in production", EnvProduction, DefaultTokenSecret, "", "", true},
+		{"short rejected", EnvProduction, "s3cr3t", "", "", true},
+		{"repetitive rejected", EnvProduction, strings.Repeat("password", 4), "", "", true},
+		{"strong accepted", EnvProduction, strong, "", strong, false},
+		{"unknown env is strict", "staging", DefaultTokenSecret, "", "", true},
+		{"read from file", EnvProduction, DefaultTokenSecret, secretFile, strong, false},
+		{"file and secret both set", EnvProduction, strong, secretFile, "", true},
+		{"missing file", EnvDevelopment, DefaultTokenSecret, filepath.Join(t.TempDir(), "missing"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Env: tt.env, TokenSecret: tt.secret, TokenSecretFile: tt.secretFile}
+			err := cfg.ResolveTokenSecret()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveTokenSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && cfg.TokenSecret != tt.want {
+				t.Errorf("TokenSecret = %q, want %q", cfg.TokenSecret, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProductionSecret(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+	if _, err := Parse("", nil); err == nil || !strings.Contains(err.Error(), "token_secret") {
+		t.Errorf("Expected production to reject the default secret, got %v", err)
+	}
+}
+
+func TestParseTenants(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+bucket_name: docs
+tenants:
+  - name: acme
+    hosts: [docs.acme.example]
+    object_prefix: acme/
+    token_secret: acme-secret
+    response_headers: {X-Tenant: acme}
+  - name: globex
+    path_prefix: /globex
+    bucket_name: globex-docs
+    docs_path: /library
+`)
+	cfg, err := Parse(path, nil)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(cfg.Tenants) != 2 {
+		t.Fatalf("Expected 2 tenants, got %d", len(cfg.Tenants))
+	}
+
+	acme := cfg.Site(cfg.Tenants[0])
+	if acme.BucketName != "docs" || acme.ObjectPrefix != "acme/" || acme.TokenSecret != "acme-secret" || acme.DocsPath != "/docs" {
+		t.Errorf("Unexpected acme site %+v", acme)
+	}
+	if acme.ResponseHeaders["X-Tenant"] != "acme" || acme.Tenants != nil {
+		t.Errorf("Unexpected acme site %+v", acme)
+	}
+
+	globex := cfg.Site(cfg.Tenants[1])
+	if globex.BucketName != "globex-docs" || globex.DocsPath != "/globex/library" || globex.RoutePrefix != "/globex" || globex.TenantName != "globex" {
+		t.Errorf("Unexpected globex site %+v", globex)
+	}
+	if globex.TokenSecret != cfg.TokenSecret {
+		t.Error("Expected globex to inherit the top-level token secret in development")
+	}
+}
+
+func TestValidateTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []Tenant
+		wantErr string
+	}{
+		{"valid", []Tenant{{Name: "a", Hosts: []string{"a.example"}}, {Name: "b", PathPrefix: "/b"}}, ""},
+		{"missing name", []Tenant{{Hosts: []string{"a.example"}}}, "name is required"},
+		{"duplicate name", []Tenant{{Name: "a", Hosts: []string{"a.example"}}, {Name: "a", PathPrefix: "/a"}}, "duplicate name"},
+		{"no selector", []Tenant{{Name: "a"}}, "hosts or path_prefix"},
+		{"shared host", []Tenant{{Name: "a", Hosts: []string{"x.example"}}, {Name: "b", Hosts: []string{"X.example"}}}, "also used by a"},
+		{"host with port", []Tenant{{Name: "a", Hosts: []string{"a.example:8443"}}}, "bare host name"},
+		{"prefix slash", []Tenant{{Name: "a", PathPrefix: "/a/"}}, "path_prefix"},
+		{"object prefix", []Tenant{{Name: "a", PathPrefix: "/a", ObjectPrefix: "a"}}, "object_prefix"},
+		{"header", []Tenant{{Name: "a", PathPrefix: "/a", ResponseHeaders: map[string]string{"X-A": "1\n2"}}}, "tenants[a].response_headers"},
+		{"frame ancestors", []Tenant{{Name: "a", PathPrefix: "/a", FrameAncestors: []string{"lms.example.com"}}}, "tenants[a].frame_ancestors"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.BucketName = "docs"
+			cfg.Tenants = tt.tenants
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveTenantSecrets(t *testing.T) {
+	strong := "q8Vx2mT9LpZr4KcW7nYb3HdJ6sFg1AeU"
+	cfg := &Config{
+		Env:         EnvProduction,
+		TokenSecret: strong,
+		Tenants: []Tenant{
+			{Name: "acme", TokenSecretFile: writeConfigFile(t, "acme-secret", "Zt4Qw8Ep1Ry6Ui3Oa9Sd2Fg7Hj5Kl0Xc\n")},
+			{Name: "globex", TokenSecret: "short"},
+		},
+	}
+	err := cfg.ResolveTokenSecret()
+	if err == nil || !strings.Contains(err.Error(), "tenants[globex]") {
+		t.Errorf("Expected globex's weak secret to be rejected, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "tenants[acme]") {
+		t.Errorf("Expected acme's secret file to be accepted, got %v", err)
+	}
+	if cfg.Tenants[0].TokenSecret != "Zt4Qw8Ep1Ry6Ui3Oa9Sd2Fg7Hj5Kl0Xc" {
+		t.Errorf("Expected acme secret to be read from file, got %q", cfg.Tenants[0].TokenSecret)
+	}
+}
+
+func TestTenantSecretRequired(t *testing.T) {
+	strong := "q8Vx2mT9LpZr4KcW7nYb3HdJ6sFg1AeU"
+	tests := []struct {
+		name    string
+		env     string
+		tenant  Tenant
+		wantErr bool
+	}{
+		{"same documents", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}}, false},
+		{"same bucket named", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}, BucketName: "docs"}, false},
+		{"own bucket", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}, BucketName: "a-docs"}, true},
+		{"own prefix", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}, ObjectPrefix: "a/"}, true},
+		{"copied secret", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}, ObjectPrefix: "a/", TokenSecret: strong}, true},
+		{"own secret", EnvProduction, Tenant{Name: "a", Hosts: []string{"a.example"}, ObjectPrefix: "a/", TokenSecret: "Zt4Qw8Ep1Ry6Ui3Oa9Sd2Fg7Hj5Kl0Xc"}, false},
+		{"development", EnvDevelopment, Tenant{Name: "a", Hosts: []string{"a.example"}, BucketName: "a-docs"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Env: tt.env, BucketName: "docs", TokenSecret: strong, Tenants: []Tenant{tt.tenant}}
+			err := cfg.ResolveTokenSecret()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveTokenSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNestedPrefixes(t *testing.T) {
+	cfg := &Config{
+		BucketName: "docs",
+		Tenants: []Tenant{
+			{Name: "acme", Hosts: []string{"acme.example"}, ObjectPrefix: "acme/"},
+			{Name: "acme-lab", Hosts: []string{"lab.acme.example"}, ObjectPrefix: "acme/lab/"},
+			{Name: "brand", Hosts: []string{"brand.example"}},
+			{Name: "globex", PathPrefix: "/globex", BucketName: "globex-docs", ObjectPrefix: "globex/"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		bucket   string
+		prefix   string
+		expected []string
+	}{
+		{"top level", "docs", "", []string{"acme/", "acme/lab/"}},
+		{"tenant folder", "docs", "acme/", []string{"lab/"}},
+		{"innermost folder", "docs", "acme/lab/", nil},
+		{"own bucket", "globex-docs", "globex/", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.NestedPrefixes(tt.bucket, tt.prefix); !slices.Equal(got, tt.expected) {
+				t.Errorf("NestedPrefixes() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+	if site := cfg.Site(cfg.Tenants[2]); !slices.Equal(site.HiddenPrefixes, []string{"acme/", "acme/lab/"}) {
+		t.Errorf("Expected tenant without a prefix to hide the other folders, got %q", site.HiddenPrefixes)
+	}
+}
+
+func TestTenantAllowedClients(t *testing.T) {
+	cfg := Default()
+	cfg.BucketName = "docs"
+	cfg.AuthMode, cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile = AuthModeMTLS, "cert.pem", "key.pem", "ca.pem"
+	cfg.TLSAllowedClients, cfg.TrustedProxyHops = []string{"portal"}, 0
+	cfg.Tenants = []Tenant{{Name: "acme", Hosts: []string{"acme.example"}}}
+
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "tenants[acme]: tls_allowed_clients") {
+		t.Errorf("Expected tenant without tls_allowed_clients to be rejected, got %v", err)
+	}
+	if site := cfg.Site(cfg.Tenants[0]); len(site.TLSAllowedClients) != 0 {
+		t.Errorf("Expected tenant not to inherit the allowed clients, got %v", site.TLSAllowedClients)
+	}
+
+	cfg.Tenants[0].TLSAllowedClients = []string{"acme-portal"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package errorpage
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+//go:embed templates/error.html
+var templates embed.FS
+
+var defaultTemplate = template.Must(template.ParseFS(templates, "templates/error.html"))
+
+// maxTemplateSize bounds error templates loaded from the bucket.
+const maxTemplateSize = 256 << 10
+
+// fetchTimeout bounds loading a template from the bucket.
+const fetchTimeout = 5 * time.Second
+
+// Page is the data passed to error templates.
+type Page struct {
+	Status     int
+	Title      string
+	Message    string
+	Detail     string
+	Support    string
+	SupportURL string
+}
+
+type wording struct {
+	title   string
+	message string
+}
+
+// messages hold the reader-facing text for each status; Detail carries the
+// specific reason.
+var messages = map[int]wording{
+	http.StatusUnauthorized: {
+		"Your access link has expired",
+		"This page needs a valid access link. Open it again from your course or portal to get a fresh link.",
+	},
+	http.StatusForbidden: {
+		"You don't have access to this page",
+		"Your access link doesn't cover this page, or it can't be opened from this site.",
+	},
+	http.StatusNotFound: {
+		"Page not found",
+		"The page you're looking for doesn't exist or has moved.",
+	},
+}
+
+// Renderer writes error responses as HTML, JSON or plain text depending on
+// the request's Accept header. HTML pages come from <prefix><status>.html in
+// the bucket when a prefix is set, falling back to the built-in template.
+type Renderer struct {
+	backend storage.Backend
+	prefix  string
+	support string
+}
+
+// New creates a Renderer. backend may be nil when prefix is empty.
+func New(backend storage.Backend, prefix, support string) *Renderer {
+	return &Renderer{backend: backend, prefix: prefix, support: support}
+}
+
+// Error writes an error response with the given status. message is the short
+// reason, e.g. "Invalid or expired token"; plain text clients get exactly
+// that, as with http.Error.
+func (p *Renderer) Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+
+	switch negotiate(r.Header.Get("Accept")) {
+	case "application/json":
+		body, _ := json.Marshal(struct {
+			Status  int    `json:"status"`
+			Error   string `json:"error"`
+			Support string `json:"support,omitempty"`
+		}{status, message, p.support})
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(append(body, '\n'))
+	case "text/html":
+		body := p.render(r.Context(), p.page(status, message))
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(body)
+	default:
+		http.Error(w, message, status)
+	}
+}
+
+func (p *Renderer) page(status int, message string) Page {
+	text, ok := messages[status]
+	if !ok {
+		text = wording{http.StatusText(status), message}
+	}
+
+	page := Page{
+		Status:  status,
+		Title:   text.title,
+		Message: text.message,
+		Detail:  message,
+		Support: p.support,
+	}
+	switch {
+	case strings.HasPrefix(p.support, "https://"), strings.HasPrefix(p.support, "http://"):
+		page.SupportURL = p.support
+	case strings.Contains(p.support, "@"):
+		page.SupportURL = "mailto:" + p.support
+	}
+	return page
+}
+
+func (p *Renderer) render(ctx context.Context, page Page) []byte {
+	tmpl := defaultTemplate
+	if p.prefix != "" && p.backend != nil {
+		custom, err := p.load(ctx, page.Status)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			logging.FromContext(ctx).Warn("Failed to load error page, using default", "status", page.Status, "error", err)
+		}
+		if custom != nil {
+			tmpl = custom
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		logging.FromContext(ctx).Warn("Failed to render error page", "status", page.Status, "error", err)
+		buf.Reset()
+		defaultTemplate.Execute(&buf, page)
+	}
+	return buf.Bytes()
+}
+
+// load reads and parses <prefix><status>.html from the bucket.
+func (p *Renderer) load(ctx context.Context, status int) (*template.Template, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	name := p.prefix + strconv.Itoa(status) + ".html"
+	fileInfo, err := p.backend.GetFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer fileInfo.Content.Close()
+
+	data, err := io.ReadAll(io.LimitReader(fileInfo.Content, maxTemplateSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	tmpl, err := template.New(name).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// offers are the response formats in the order preferred when the client
+// rates several equally; plain text first keeps http.Error behaviour for
+// clients sending "*/*".
+var offers = []string{"text/plain", "text/html", "application/json"}
+
+// negotiate picks the offer with the highest quality in the Accept header.
+func negotiate(accept string) string {
+	if accept == "" {
+		return offers[0]
+	}
+
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := quality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// quality returns the q-value of the most specific media range in accept
+// that matches offer.
+func quality(accept, offer string) float64 {
+	offerType, _, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case mediaType == offer:
+			s = 2
+		case mediaType == offerType+"/*":
+			s = 1
+		case mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		specificity, q = s, 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+	}
+	return q
+}
@@ -0,0 +1,153 @@
+package errorpage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+type stubBackend map[string]string
+
+func (b stubBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	content, ok := b[objectPath]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+	}
+	return &storage.FileInfo{
+		Content: nopCloser{strings.NewReader(content)},
+		Size:    int64(len(content)),
+	}, nil
+}
+
+type nopCloser struct {
+	*strings.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "text/plain"},
+		{"*/*", "text/plain"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"application/json", "application/json"},
+		{"application/json, text/plain;q=0.5", "application/json"},
+		{"text/*", "text/plain"},
+		{"text/*;q=0.5, text/html", "text/html"},
+		{"image/png", "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := negotiate(tt.accept); got != tt.want {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRendererError(t *testing.T) {
+	renderer := New(nil, "", "help@example.com")
+
+	tests := []struct {
+		name        string
+		accept      string
+		contentType string
+		contains    []string
+	}{
+		{"plain", "*/*", "text/plain; charset=utf-8", []string{"Invalid or expired token"}},
+		{"html", "text/html", "text/html; charset=utf-8", []string{
+			"Your access link has expired",
+			"Invalid or expired token",
+			`href="mailto:help@example.com"`,
+		}},
+		{"json", "application/json", "application/json", []string{`"error":"Invalid or expired token"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/index.html", nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+
+			renderer.Error(rr, req, http.StatusUnauthorized, "Invalid or expired token")
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Expected Content-Type %q, got %q", tt.contentType, got)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("Expected body to contain %q, got %s", want, rr.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRendererJSON(t *testing.T) {
+	renderer := New(nil, "", "https://support.example.com")
+	req := httptest.NewRequest("GET", "/docs/missing.html", nil)
+	req.Header.Set("Accept", "application/json")
+	rr := httptest.NewRecorder()
+
+	renderer.Error(rr, req, http.StatusNotFound, "File not found")
+
+	var body struct {
+		Status  int    `json:"status"`
+		Error   string `json:"error"`
+		Support string `json:"support"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != 404 || body.Error != "File not found" || body.Support != "https://support.example.com" {
+		t.Errorf("Unexpected body %+v", body)
+	}
+}
+
+func TestRendererBucketTemplates(t *testing.T) {
+	backend := stubBackend{
+		"_errors/404.html": `<h1>Acme Academy: {{.Title}}</h1><p>{{.Support}}</p>`,
+		"_errors/403.html": `{{.Broken`,
+	}
+	renderer := New(backend, "_errors/", "help@example.com")
+
+	tests := []struct {
+		name     string
+		status   int
+		contains string
+	}{
+		{"custom template", http.StatusNotFound, "<h1>Acme Academy: Page not found</h1><p>help@example.com</p>"},
+		{"invalid template falls back", http.StatusForbidden, "You don&#39;t have access to this page"},
+		{"missing template falls back", http.StatusUnauthorized, "Your access link has expired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/page.html", nil)
+			req.Header.Set("Accept", "text/html")
+			rr := httptest.NewRecorder()
+
+			renderer.Error(rr, req, tt.status, http.StatusText(tt.status))
+
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.contains) {
+				t.Errorf("Expected body to contain %q, got %s", tt.contains, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+// Check is one readiness condition. Run returns nil when it holds; the error
+// text is shown in the response, so it shouldn't carry secrets.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Checker runs readiness checks for /ready. Results are cached for a short
+// time so frequent probes from many instances don't each hit storage.
+type Checker struct {
+	checks   []Check
+	ttl      time.Duration
+	timeout  time.Duration
+	draining atomic.Bool
+	now      func() time.Time
+
+	mu      sync.Mutex
+	results map[string]result
+}
+
+type result struct {
+	err     error
+	latency time.Duration
+	at      time.Time
+}
+
+// CheckStatus is one check in the /ready response.
+type CheckStatus struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Status is the /ready response body.
+type Status struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// NewChecker caches each result for ttl and gives each run timeout.
+func NewChecker(ttl, timeout time.Duration, checks ...Check) *Checker {
+	return &Checker{
+		checks:  checks,
+		ttl:     ttl,
+		timeout: timeout,
+		now:     time.Now,
+		results: map[string]result{},
+	}
+}
+
+// Drain marks the instance not ready, e.g. on SIGTERM, so load balancers
+// stop sending new requests while in-flight ones finish.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Status runs the checks concurrently, reusing fresh cached results.
+func (c *Checker) Status(ctx context.Context) Status {
+	status := Status{Status: "ready", Checks: make(map[string]CheckStatus, len(c.checks))}
+
+	results := make([]result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range c.checks {
+		cs := CheckStatus{Status: "ok", LatencyMS: float64(results[i].latency.Microseconds()) / 1000}
+		if err := results[i].err; err != nil {
+			cs.Status, cs.Error = "failed", err.Error()
+			status.Status = "not_ready"
+		}
+		status.Checks[check.Name] = cs
+	}
+	if c.draining.Load() {
+		status.Status = "shutting_down"
+	}
+	return status
+}
+
+func (c *Checker) run(ctx context.Context, check Check) result {
+	c.mu.Lock()
+	cached, ok := c.results[check.Name]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.at) < c.ttl {
+		return cached
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := c.now()
+	err := check.Run(ctx)
+	res := result{err: err, latency: c.now().Sub(start), at: c.now()}
+
+	c.mu.Lock()
+	c.results[check.Name] = res
+	c.mu.Unlock()
+	return res
+}
+
+// Handler serves the check results as JSON: 200 when every check passes,
+// 503 otherwise.
+func (c *Checker) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status(r.Context())
+		code := http.StatusOK
+		if status.Status != "ready" {
+			code = http.StatusServiceUnavailable
+			logging.FromContext(r.Context()).Warn("Readiness check failed", "status", status.Status, "checks", status.Checks)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(status)
+	}
+}
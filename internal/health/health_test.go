@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	ok := Check{Name: "storage", Run: func(context.Context) error { return nil }}
+	broken := Check{Name: "config", Run: func(context.Context) error { return errors.New("bad config") }}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		drain      bool
+		wantCode   int
+		wantStatus string
+	}{
+		{"all checks pass", []Check{ok}, false, http.StatusOK, "ready"},
+		{"one check fails", []Check{ok, broken}, false, http.StatusServiceUnavailable, "not_ready"},
+		{"draining", []Check{ok}, true, http.StatusServiceUnavailable, "shutting_down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(time.Minute, time.Second, tt.checks...)
+			if tt.drain {
+				checker.Drain()
+			}
+
+			rr := httptest.NewRecorder()
+			checker.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/ready", nil))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("Expected status %d, got %d", tt.wantCode, rr.Code)
+			}
+			var status Status
+			if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+				t.Fatal(err)
+			}
+			if status.Status != tt.wantStatus {
+				t.Errorf("Expected %q, got %q", tt.wantStatus, status.Status)
+			}
+			if len(status.Checks) != len(tt.checks) {
+				t.Errorf("Expected %d checks, got %v", len(tt.checks), status.Checks)
+			}
+		})
+	}
+}
+
+func TestCheckerCachesResults(t *testing.T) {
+	calls := 0
+	check := Check{Name: "storage", Run: func(context.Context) error { calls++; return nil }}
+	checker := NewChecker(10*time.Second, time.Second, check)
+	now := time.Now()
+	checker.now = func() time.Time { return now }
+
+	checker.Status(context.Background())
+	checker.Status(context.Background())
+	if calls != 1 {
+		t.Errorf("Expected cached result within TTL, got %d calls", calls)
+	}
+
+	now = now.Add(11 * time.Second)
+	checker.Status(context.Background())
+	if calls != 2 {
+		t.Errorf("Expected check to rerun after TTL, got %d calls", calls)
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	check := Check{Name: "storage", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	checker := NewChecker(0, 10*time.Millisecond, check)
+
+	status := checker.Status(context.Background())
+	if status.Status != "not_ready" || status.Checks["storage"].Error == "" {
+		t.Errorf("Expected a hanging check to fail, got %+v", status)
+	}
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// LevelCritical has no slog equivalent; it maps to Cloud Logging's CRITICAL.
+const LevelCritical = slog.Level(12)
+
+// ParseLevel converts a LOG_LEVEL value such as "debug" or "warning".
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	case "critical":
+		return LevelCritical, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("invalid log level %q", s)
+}
+
+// New returns a JSON logger whose records use Cloud Logging's field names:
+// "severity" instead of "level" and "message" instead of "msg".
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: replaceAttr,
+	}))
+}
+
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		return slog.String("severity", severity(a.Value.Any().(slog.Level)))
+	case slog.MessageKey:
+		a.Key = "message"
+	}
+	return a
+}
+
+func severity(level slog.Level) string {
+	switch {
+	case level >= LevelCritical:
+		return "CRITICAL"
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+type contextKey struct{}
+
+// requestAttrs collects attributes for one request. Middlewares deeper in the
+// chain add to it (e.g. the token ID) and the access log line picks them up.
+type requestAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+func withRequestAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, contextKey{}, &requestAttrs{attrs: attrs})
+}
+
+// AddAttrs attaches attributes to the current request's log records. It does
+// nothing outside a request logged by Middleware.
+func AddAttrs(ctx context.Context, attrs ...slog.Attr) {
+	if ra, ok := ctx.Value(contextKey{}).(*requestAttrs); ok {
+		ra.mu.Lock()
+		ra.attrs = append(ra.attrs, attrs...)
+		ra.mu.Unlock()
+	}
+}
+
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	ra, ok := ctx.Value(contextKey{}).(*requestAttrs)
+	if !ok {
+		return nil
+	}
+	ra.mu.Lock()
+	defer ra.mu.Unlock()
+	return append([]slog.Attr(nil), ra.attrs...)
+}
+
+// FromContext returns the default logger with the request's attributes.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	attrs := attrsFromContext(ctx)
+	if len(attrs) == 0 {
+		return logger
+	}
+	args := make([]any, len(attrs))
+	for i, attr := range attrs {
+		args[i] = attr
+	}
+	return logger.With(args...)
+}
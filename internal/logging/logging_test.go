@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"", slog.LevelInfo, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"warning", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"critical", LevelCritical, false},
+		{"verbose", slog.LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLevel(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid JSON log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestNewCloudLoggingFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Debug("hidden")
+	logger.Info("started", "port", "8080")
+	logger.Warn("slow")
+	logger.Log(t.Context(), LevelCritical, "down")
+
+	records := decodeLines(t, &buf)
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records at info level, got %d", len(records))
+	}
+
+	want := []struct{ severity, message string }{
+		{"INFO", "started"},
+		{"WARNING", "slow"},
+		{"CRITICAL", "down"},
+	}
+	for i, w := range want {
+		if records[i]["severity"] != w.severity || records[i]["message"] != w.message {
+			t.Errorf("Record %d = %v, want severity %s message %s", i, records[i], w.severity, w.message)
+		}
+		if _, ok := records[i]["level"]; ok {
+			t.Errorf("Record %d should not have a level field", i)
+		}
+	}
+	if records[0]["port"] != "8080" {
+		t.Errorf("Expected port attribute, got %v", records[0])
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(New(&buf, slog.LevelInfo))
+	defer slog.SetDefault(previous)
+
+	handler := middleware.RequestID(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddAttrs(r.Context(), slog.String("token_id", "tok-123"))
+		FromContext(r.Context()).Info("inside handler")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("File not found"))
+	})))
+
+	req := httptest.NewRequest("GET", "/docs/missing.html?token=secret", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := decodeLines(t, &buf)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d: %s", len(records), buf.String())
+	}
+
+	inner, access := records[0], records[1]
+	if inner["token_id"] != "tok-123" || inner["request_id"] == nil {
+		t.Errorf("Expected request attributes on handler log, got %v", inner)
+	}
+
+	if access["severity"] != "WARNING" {
+		t.Errorf("Expected WARNING for 404, got %v", access["severity"])
+	}
+	if access["token_id"] != "tok-123" || access["request_id"] == nil {
+		t.Errorf("Expected request attributes on access log, got %v", access)
+	}
+	if access["status"] != float64(404) || access["bytes"] != float64(14) || access["path"] != "/docs/missing.html" {
+		t.Errorf("Unexpected access log fields %v", access)
+	}
+	httpRequest, _ := access["httpRequest"].(map[string]any)
+	if httpRequest["requestMethod"] != "GET" || httpRequest["status"] != float64(404) {
+		t.Errorf("Unexpected httpRequest %v", httpRequest)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Error("Query string must not be logged")
+	}
+}
@@ -0,0 +1,59 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Middleware writes one access log record per request, using Cloud Logging's
+// httpRequest field so the request shows up in the request log view. Only the
+// path is logged, never the query string, which may carry a token. It must
+// run after middleware.RequestID.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		var attrs []slog.Attr
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		ctx := withRequestAttrs(r.Context(), attrs...)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		latency := time.Since(start)
+		FromContext(ctx).LogAttrs(ctx, level, fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status),
+			slog.Group("httpRequest",
+				slog.String("requestMethod", r.Method),
+				slog.String("requestUrl", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("responseSize", ww.BytesWritten()),
+				slog.String("userAgent", r.UserAgent()),
+				slog.String("remoteIp", r.RemoteAddr),
+				slog.String("protocol", r.Proto),
+				slog.String("latency", fmt.Sprintf("%.6fs", latency.Seconds())),
+			),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Float64("latency_ms", float64(latency.Microseconds())/1000),
+		)
+	})
+}
@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pavelanni/cloud-docs/internal/cache"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+const namespace = "clouddocs"
+
+// Metrics holds the server's Prometheus collectors in a dedicated registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	responseBytes   *prometheus.CounterVec
+	inFlight        prometheus.Gauge
+
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+
+	tokenValidations *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		responseBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_response_bytes_total",
+			Help:      "Response body bytes served by route.",
+		}, []string{"route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_request_duration_seconds",
+			Help:      "Storage backend call latency by operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage backend calls by operation and kind (not_found or error).",
+		}, []string{"operation", "kind"}),
+
+		tokenValidations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validations_total",
+			Help:      "Token validations by outcome (valid, missing, expired, bad_signature, malformed).",
+		}, []string{"outcome"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.responseBytes,
+		m.inFlight,
+		m.storageDuration,
+		m.storageErrors,
+		m.tokenValidations,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records request counts, latency and bytes by chi route pattern,
+// so /docs/{path} is one series rather than one per document.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := routePattern(r)
+		statusLabel := strconv.Itoa(status)
+
+		m.requests.WithLabelValues(route, r.Method, statusLabel).Inc()
+		m.requestDuration.WithLabelValues(route, r.Method, statusLabel).Observe(time.Since(start).Seconds())
+		m.responseBytes.WithLabelValues(route).Add(float64(ww.BytesWritten()))
+	})
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
+
+// ObserveToken counts a token validation outcome; pass it to
+// auth.WithTokenObserver.
+func (m *Metrics) ObserveToken(outcome string) {
+	m.tokenValidations.WithLabelValues(outcome).Inc()
+}
+
+// InstrumentBackend records latency and errors of calls to backend. Wrap the
+// storage client itself so cache hits aren't counted as storage calls.
+func (m *Metrics) InstrumentBackend(backend storage.Backend) storage.Backend {
+	return &instrumentedBackend{backend: backend, metrics: m}
+}
+
+type instrumentedBackend struct {
+	backend storage.Backend
+	metrics *Metrics
+}
+
+func (b *instrumentedBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	start := time.Now()
+	fileInfo, err := b.backend.GetFile(ctx, objectPath)
+	b.metrics.storageDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		b.metrics.storageErrors.WithLabelValues("get", "not_found").Inc()
+	case err != nil:
+		b.metrics.storageErrors.WithLabelValues("get", "error").Inc()
+	}
+	return fileInfo, err
+}
+
+// RegisterCache exports a cache's counters under the given tier label
+// ("memory" or "disk").
+func (m *Metrics) RegisterCache(tier string, stats func() cache.Stats) {
+	labels := prometheus.Labels{"tier": tier}
+	counter := func(name, help string, value func(cache.Stats) float64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: name, Help: help, ConstLabels: labels,
+		}, func() float64 { return value(stats()) })
+	}
+	gauge := func(name, help string, value func(cache.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "cache", Name: name, Help: help, ConstLabels: labels,
+		}, func() float64 { return value(stats()) })
+	}
+
+	m.registry.MustRegister(
+		counter("hits_total", "Cache hits.", func(s cache.Stats) float64 { return float64(s.Hits) }),
+		counter("misses_total", "Cache misses.", func(s cache.Stats) float64 { return float64(s.Misses) }),
+		counter("evictions_total", "Entries evicted to stay within the size limit.", func(s cache.Stats) float64 { return float64(s.Evictions) }),
+		gauge("entries", "Entries currently cached.", func(s cache.Stats) float64 { return float64(s.Entries) }),
+		gauge("bytes", "Bytes currently cached.", func(s cache.Stats) float64 { return float64(s.Bytes) }),
+	)
+}
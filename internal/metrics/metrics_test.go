@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/pavelanni/cloud-docs/internal/cache"
+	"github.com/pavelanni/cloud-docs/internal/storage"
+)
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	m := New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/docs/*", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "missing.html") {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	for _, path := range []string{"/docs/a.html", "/docs/b.html", "/docs/missing.html", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	tests := []struct {
+		route, status string
+		want          float64
+	}{
+		{"/docs/*", "200", 2},
+		{"/docs/*", "404", 1},
+		{"unmatched", "404", 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(m.requests.WithLabelValues(tt.route, "GET", tt.status)); got != tt.want {
+			t.Errorf("requests{route=%q,status=%q} = %v, want %v", tt.route, tt.status, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(m.responseBytes.WithLabelValues("/docs/*")); got != 10+15 {
+		t.Errorf("Expected 25 response bytes, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.inFlight); got != 0 {
+		t.Errorf("Expected no requests in flight, got %v", got)
+	}
+}
+
+type stubBackend struct{}
+
+func (stubBackend) GetFile(ctx context.Context, objectPath string) (*storage.FileInfo, error) {
+	switch objectPath {
+	case "missing.html":
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, objectPath)
+	case "broken.html":
+		return nil, fmt.Errorf("failed to get object attributes: timeout")
+	}
+	return &storage.FileInfo{}, nil
+}
+
+func TestInstrumentBackend(t *testing.T) {
+	m := New()
+	backend := m.InstrumentBackend(stubBackend{})
+
+	for _, name := range []string{"index.html", "missing.html", "broken.html", "broken.html"} {
+		backend.GetFile(context.Background(), name)
+	}
+
+	if got := testutil.ToFloat64(m.storageErrors.WithLabelValues("get", "not_found")); got != 1 {
+		t.Errorf("Expected 1 not_found error, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.storageErrors.WithLabelValues("get", "error")); got != 2 {
+		t.Errorf("Expected 2 errors, got %v", got)
+	}
+	if got := testutil.CollectAndCount(m.storageDuration); got != 1 {
+		t.Errorf("Expected one storage latency series, got %d", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.ObserveToken("expired")
+	m.ObserveToken("expired")
+	m.RegisterCache("memory", func() cache.Stats { return cache.Stats{Hits: 7, Bytes: 1024} })
+
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rr.Body)
+
+	for _, want := range []string{
+		`clouddocs_token_validations_total{outcome="expired"} 2`,
+		`clouddocs_cache_hits_total{tier="memory"} 7`,
+		`clouddocs_cache_bytes{tier="memory"} 1024`,
+		`clouddocs_http_requests_in_flight 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected metrics output to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+// Limit describes a token bucket refilled at Rate requests per second that
+// holds at most Burst requests. A zero Limit disables limiting.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Store keeps bucket state. MemoryStore limits per instance; implement Store
+// on a shared backend (Redis, Memorystore) to enforce limits across instances.
+type Store interface {
+	// Take consumes one request from the bucket for key. When the bucket is
+	// empty it reports how long until the next request would be allowed.
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	refill time.Duration // time to go from empty to full
+}
+
+// MemoryStore is an in-process Store. Buckets that have been idle long enough
+// to refill completely are dropped, so memory stays bounded by active clients.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: float64(limit.Burst),
+			last:   now,
+			refill: time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second)),
+		}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > b.refill {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// KeyFunc selects the bucket for a request. An empty key skips limiting.
+type KeyFunc func(r *http.Request) string
+
+// RealIP replaces RemoteAddr with the client address recorded by the
+// trustedHops proxies in front of the server (1 on Cloud Run), i.e. the
+// trustedHops-th X-Forwarded-For entry from the right. Entries further left
+// are set by the client and could be rotated to dodge per-IP limits. Zero
+// keeps the connection address, for a server exposed directly.
+func RealIP(trustedHops int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if trustedHops <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var hops []string
+			for _, header := range r.Header.Values("X-Forwarded-For") {
+				for _, hop := range strings.Split(header, ",") {
+					hops = append(hops, strings.TrimSpace(hop))
+				}
+			}
+			if len(hops) >= trustedHops {
+				if ip := net.ParseIP(hops[len(hops)-trustedHops]); ip != nil {
+					r.RemoteAddr = ip.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ByIP keys requests by client address. It relies on RealIP having replaced
+// RemoteAddr with the forwarded client address.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByToken keys requests by the ID of the validated token, so it must run after
+// auth.TokenMiddleware.
+func ByToken(r *http.Request) string {
+	if t := auth.GetTokenFromContext(r.Context()); t != nil {
+		return "token:" + t.ID
+	}
+	return ""
+}
+
+// Middleware rejects requests over limit with 429 and a Retry-After header.
+// Store errors fail open so a shared store outage doesn't take docs down.
+func Middleware(store Store, limit Limit, keyFunc KeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !limit.Enabled() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFunc(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, retryAfter, err := store.Take(r.Context(), key, limit)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("Rate limit store error, allowing request", "path", r.URL.Path, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func TestMemoryStoreTake(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := store.Take(ctx, "k", limit); !allowed {
+			t.Fatalf("Request %d within burst was rejected", i+1)
+		}
+	}
+
+	allowed, retryAfter, _ := store.Take(ctx, "k", limit)
+	if allowed {
+		t.Fatal("Expected request over burst to be rejected")
+	}
+	if retryAfter != 500*time.Millisecond {
+		t.Errorf("Expected retry after 500ms, got %v", retryAfter)
+	}
+
+	if allowed, _, _ := store.Take(ctx, "other", limit); !allowed {
+		t.Error("Expected separate key to have its own bucket")
+	}
+
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	if allowed, _, _ := store.Take(ctx, "k", limit); !allowed {
+		t.Error("Expected bucket to refill over time")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+
+	limit := Limit{Rate: 1, Burst: 5}
+	store.Take(context.Background(), "idle", limit)
+
+	clock.now = clock.now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "active", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("Expected idle bucket to be swept")
+	}
+	if _, ok := store.buckets["active"]; !ok {
+		t.Error("Expected active bucket to remain")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware(NewMemoryStore(), Limit{Rate: 1, Burst: 2}, ByIP)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	expected := []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}
+	for i, status := range expected {
+		req := httptest.NewRequest("GET", "/docs/static/main.css", nil)
+		req.RemoteAddr = "203.0.113.7:51234"
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != status {
+			t.Errorf("Request %d: expected status %d, got %d", i+1, status, rr.Code)
+		}
+		if status == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("Expected Retry-After: 1, got %q", rr.Header().Get("Retry-After"))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/docs/static/main.css", nil)
+	req.RemoteAddr = "198.51.100.1:40000"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected other client to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestMiddlewareDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := Middleware(NewMemoryStore(), Limit{}, ByIP)(next)
+
+	for i := 0; i < 100; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected disabled limiter to allow all requests, got %d", rr.Code)
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest("GET", "/docs/index.html", nil)
+	req.RemoteAddr = "203.0.113.7"
+	if key := ByIP(req); key != "ip:203.0.113.7" {
+		t.Errorf("ByIP() = %q", key)
+	}
+
+	if key := ByToken(req); key != "" {
+		t.Errorf("ByToken() without token = %q, want empty", key)
+	}
+
+	ctx := context.WithValue(req.Context(), auth.TokenContextKey, &token.Token{ID: "abc"})
+	if key := ByToken(req.WithContext(ctx)); key != "token:abc" {
+		t.Errorf("ByToken() = %q", key)
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		trustedHops  int
+		forwardedFor []string
+		expectedAddr string
+	}{
+		{"no proxy", 0, []string{"198.51.100.1"}, "192.0.2.1:1234"},
+		{"client cannot rotate leftmost entry", 1, []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"two proxies", 2, []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"separate header lines", 2, []string{"203.0.113.7", "10.0.0.2"}, "203.0.113.7"},
+		{"fewer entries than hops", 2, []string{"203.0.113.7"}, "192.0.2.1:1234"},
+		{"not an address", 1, []string{"unknown"}, "192.0.2.1:1234"},
+		{"no header", 1, nil, "192.0.2.1:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/docs/index.html", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+
+			var got string
+			RealIP(tt.trustedHops)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expectedAddr {
+				t.Errorf("Expected RemoteAddr %q, got %q", tt.expectedAddr, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// rangeOpener opens a reader for length bytes starting at offset; a negative
+// length reads to the end of the object.
+type rangeOpener func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// rangeReader is a seekable view of a stored object. Nothing is fetched until
+// the first Read, and each Seek to a new position reopens the object with a
+// ranged read, so serving a byte range never downloads the whole object.
+type rangeReader struct {
+	ctx    context.Context
+	open   rangeOpener
+	size   int64
+	offset int64
+	reader io.ReadCloser
+}
+
+func newRangeReader(ctx context.Context, size int64, open rangeOpener) *rangeReader {
+	return &rangeReader{ctx: ctx, open: open, size: size}
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.reader == nil {
+		reader, err := r.open(r.ctx, r.offset, -1)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create object reader: %w", err)
+		}
+		r.reader = reader
+	}
+
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.offset + offset
+	case io.SeekEnd:
+		target = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != r.offset && r.reader != nil {
+		r.reader.Close()
+		r.reader = nil
+	}
+	r.offset = target
+	return target, nil
+}
+
+func (r *rangeReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	r.reader = nil
+	return err
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+type openCall struct {
+	offset, length int64
+}
+
+func newTestRangeReader(content string, calls *[]openCall) *rangeReader {
+	open := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		*calls = append(*calls, openCall{offset, length})
+		return io.NopCloser(strings.NewReader(content[offset:])), nil
+	}
+	return newRangeReader(context.Background(), int64(len(content)), open)
+}
+
+func TestRangeReaderLazyOpen(t *testing.T) {
+	var calls []openCall
+	reader := newTestRangeReader("hello world", &calls)
+
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err != nil || size != 11 {
+		t.Fatalf("Seek(0, SeekEnd) = %d, %v", size, err)
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 0 {
+		t.Errorf("Expected no object reads without Read, got %v", calls)
+	}
+}
+
+func TestRangeReaderSeekReopens(t *testing.T) {
+	var calls []openCall
+	reader := newTestRangeReader("hello world", &calls)
+	defer reader.Close()
+
+	if _, err := reader.Seek(6, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "world" {
+		t.Errorf("Expected %q, got %q", "world", buf)
+	}
+
+	if _, err := reader.Seek(-11, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("Expected %q, got %q", "hello", buf)
+	}
+
+	expected := []openCall{{6, -1}, {0, -1}}
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected opens %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Open %d: expected %v, got %v", i, expected[i], calls[i])
+		}
+	}
+}
+
+func TestRangeReaderEOF(t *testing.T) {
+	var calls []openCall
+	reader := newTestRangeReader("abc", &calls)
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" {
+		t.Errorf("Expected %q, got %q", "abc", data)
+	}
+
+	if _, err := reader.Seek(-1, io.SeekStart); err == nil {
+		t.Error("Expected error seeking before start")
+	}
+}
@@ -2,26 +2,52 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type Client struct {
 	client     *storage.Client
 	bucketName string
+	// tracer comes from the global provider, a no-op unless tracing is set up
+	tracer trace.Tracer
 }
 
+// ErrNotFound is returned (wrapped) when an object does not exist.
+var ErrNotFound = errors.New("file not found")
+
+// Backend is the read side of the object store that documents are served from.
+type Backend interface {
+	GetFile(ctx context.Context, objectPath string) (*FileInfo, error)
+}
+
+// FileInfo describes a stored object. Content is seekable so handlers can
+// serve byte ranges; implementations should defer fetching data until Content
+// is first read.
 type FileInfo struct {
-	Content     io.ReadCloser
+	Content     io.ReadSeekCloser
 	ContentType string
 	Size        int64
+
+	// Validators for conditional requests. Generation changes on every
+	// overwrite of the object; ETag is the backend's opaque entity tag.
+	Generation int64
+	ETag       string
+	Updated    time.Time
 }
 
 func NewClient(ctx context.Context, bucketName string) (*Client, error) {
@@ -48,6 +74,7 @@ func NewClient(ctx context.Context, bucketName string) (*Client, error) {
 	return &Client{
 		client:     client,
 		bucketName: bucketName,
+		tracer:     otel.Tracer("github.com/pavelanni/cloud-docs/internal/storage"),
 	}, nil
 }
 
@@ -55,33 +82,53 @@ func (c *Client) Close() error {
 	return c.client.Close()
 }
 
+// GetFile looks up an object's attributes. No object data is downloaded until
+// Content is read, so callers answering HEAD or 304 only pay for the lookup.
 func (c *Client) GetFile(ctx context.Context, objectPath string) (*FileInfo, error) {
 	objectPath = strings.TrimPrefix(objectPath, "/")
 	
 	obj := c.client.Bucket(c.bucketName).Object(objectPath)
 	
-	attrs, err := obj.Attrs(ctx)
+	attrsCtx, span := c.tracer.Start(ctx, "storage.GetFile", trace.WithAttributes(c.spanAttrs(objectPath)...))
+	defer span.End()
+	attrs, err := obj.Attrs(attrsCtx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist || strings.Contains(err.Error(), "storage: object doesn't exist") {
-			return nil, fmt.Errorf("file not found: %s", objectPath)
+			span.SetAttributes(attribute.Bool("storage.found", false))
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, objectPath)
 		}
+		recordError(span, err)
 		return nil, fmt.Errorf("failed to get object attributes: %w", err)
 	}
-
-	reader, err := obj.NewReader(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create object reader: %w", err)
-	}
+	span.SetAttributes(attribute.Bool("storage.found", true), attribute.Int64("storage.size", attrs.Size))
 
 	contentType := attrs.ContentType
 	if contentType == "" {
 		contentType = detectContentType(objectPath)
 	}
 
+	// Pin reads to the generation we just described so the content can't
+	// change underneath a multi-range response.
+	obj = obj.Generation(attrs.Generation)
+	open := func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		ctx, span := c.tracer.Start(ctx, "storage.ReadObject", trace.WithAttributes(
+			append(c.spanAttrs(objectPath), attribute.Int64("storage.offset", offset))...))
+		reader, err := obj.NewRangeReader(ctx, offset, length)
+		if err != nil {
+			recordError(span, err)
+			span.End()
+			return nil, err
+		}
+		return &spanReadCloser{ReadCloser: reader, span: span}, nil
+	}
+
 	return &FileInfo{
-		Content:     reader,
+		Content:     newRangeReader(ctx, attrs.Size, open),
 		ContentType: contentType,
 		Size:        attrs.Size,
+		Generation:  attrs.Generation,
+		ETag:        attrs.Etag,
+		Updated:     attrs.Updated,
 	}, nil
 }
 
@@ -122,6 +169,9 @@ func detectContentType(filename string) string {
 func (c *Client) UploadFile(ctx context.Context, objectPath string, content io.Reader, contentType string) error {
 	objectPath = strings.TrimPrefix(objectPath, "/")
 	
+	ctx, span := c.tracer.Start(ctx, "storage.UploadFile", trace.WithAttributes(c.spanAttrs(objectPath)...))
+	defer span.End()
+	
 	obj := c.client.Bucket(c.bucketName).Object(objectPath)
 	writer := obj.NewWriter(ctx)
 	
@@ -130,14 +180,81 @@ func (c *Client) UploadFile(ctx context.Context, objectPath string, content io.R
 	}
 	writer.ContentType = contentType
 	
-	if _, err := io.Copy(writer, content); err != nil {
+	written, err := io.Copy(writer, content)
+	span.SetAttributes(attribute.Int64("storage.size", written))
+	if err != nil {
 		writer.Close()
+		recordError(span, err)
 		return fmt.Errorf("failed to upload file %s: %w", objectPath, err)
 	}
 	
 	if err := writer.Close(); err != nil {
+		recordError(span, err)
 		return fmt.Errorf("failed to close writer for %s: %w", objectPath, err)
 	}
 	
 	return nil
+}
+
+// Ping checks that the bucket is reachable with the current credentials. With
+// a probe object it reads that object's attributes; otherwise it lists at most
+// one object, which needs only object read permissions.
+func (c *Client) Ping(ctx context.Context, probeObject string) error {
+	if probeObject != "" {
+		_, err := c.client.Bucket(c.bucketName).Object(strings.TrimPrefix(probeObject, "/")).Attrs(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read probe object: %w", err)
+		}
+		return nil
+	}
+	
+	it := c.client.Bucket(c.bucketName).Objects(ctx, nil)
+	it.PageInfo().MaxSize = 1
+	if _, err := it.Next(); err != nil && err != iterator.Done {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	return nil
+}
+
+// ListFiles returns the names of objects under prefix.
+func (c *Client) ListFiles(ctx context.Context, prefix string) ([]string, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+	
+	var names []string
+	it := c.client.Bucket(c.bucketName).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+		}
+		names = append(names, attrs.Name)
+	}
+}
+
+func (c *Client) spanAttrs(objectPath string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("storage.bucket", c.bucketName),
+		attribute.String("storage.object", objectPath),
+	}
+}
+
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// spanReadCloser ends a read span when the object reader is closed, so the
+// span covers the whole download rather than just opening it.
+type spanReadCloser struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (r *spanReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.span.End()
+	return err
 }
\ No newline at end of file
@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/pavelanni/cloud-docs/internal/logging"
+)
+
+func TestSetupExporters(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{"none", false},
+		{"", false},
+		{"stdout", false},
+		{"jaeger", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), tt.exporter, 1.0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup(%q) error = %v, wantErr %v", tt.exporter, err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&logs, slog.LevelInfo))
+	defer slog.SetDefault(previous)
+
+	r := chi.NewRouter()
+	r.Use(logging.Middleware)
+	r.Use(Middleware)
+	r.Get("/docs/*", func(w http.ResponseWriter, r *http.Request) {})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/docs/guide.html?token=secret", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /docs/*" {
+		t.Errorf("Expected span name %q, got %q", "GET /docs/*", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected trace ID %s from traceparent, got %s", traceID, got)
+	}
+	for _, kv := range span.Attributes() {
+		if bytes.Contains([]byte(kv.Value.Emit()), []byte("secret")) {
+			t.Errorf("Span attribute %s contains the query string", kv.Key)
+		}
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("Invalid log record %q: %v", logs.String(), err)
+	}
+	if record["trace_id"] != traceID {
+		t.Errorf("Expected trace_id %s in access log, got %v", traceID, record["trace_id"])
+	}
+}
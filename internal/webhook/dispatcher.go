@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event types.
+const (
+	DocumentViewed = "document.viewed"
+	TokenFirstUsed = "token.first_used"
+	TokenExpired   = "token.expired"
+	TokenRejected  = "token.rejected"
+)
+
+// AllEvents lists every event type, the default subscription.
+var AllEvents = []string{DocumentViewed, TokenFirstUsed, TokenExpired, TokenRejected}
+
+// Event is the JSON body POSTed to each endpoint. Tenant names the site the
+// request went to and is empty for the top-level site.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Tenant    string    `json:"tenant,omitempty"`
+	TokenID   string    `json:"token_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// Options tune delivery. Zero values take the defaults.
+type Options struct {
+	// Events limits deliveries to these types (default AllEvents).
+	Events []string
+	// QueueSize bounds pending deliveries; events beyond it are dropped.
+	QueueSize int
+	Workers   int
+	// MaxAttempts per delivery, including the first.
+	MaxAttempts int
+	Timeout     time.Duration
+}
+
+// Stats counts deliveries since the dispatcher started.
+type Stats struct {
+	Delivered uint64
+	Failed    uint64
+	Dropped   uint64
+}
+
+// Dispatcher delivers events to webhook endpoints from background workers,
+// so sending never blocks a request. Each body is signed with HMAC-SHA256
+// in the X-Webhook-Signature header.
+type Dispatcher struct {
+	endpoints   []string
+	secret      []byte
+	events      map[string]bool
+	maxAttempts int
+	client      *http.Client
+	backoff     func(attempt int) time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan delivery
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	delivered atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type delivery struct {
+	endpoint string
+	event    Event
+}
+
+func NewDispatcher(endpoints []string, secret string, opts Options) *Dispatcher {
+	if len(opts.Events) == 0 {
+		opts.Events = AllEvents
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		endpoints:   endpoints,
+		secret:      []byte(secret),
+		events:      map[string]bool{},
+		maxAttempts: opts.MaxAttempts,
+		client:      &http.Client{Timeout: opts.Timeout},
+		backoff:     backoff,
+		queue:       make(chan delivery, opts.QueueSize),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	for _, event := range opts.Events {
+		d.events[event] = true
+	}
+	for i := 0; i < opts.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Send queues event for every endpoint. It never blocks: when the queue is
+// full or the dispatcher is closed the event is dropped.
+func (d *Dispatcher) Send(event Event) {
+	if !d.events[event.Type] {
+		return
+	}
+	if event.ID == "" {
+		event.ID = newEventID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, endpoint := range d.endpoints {
+		if d.closed {
+			d.dropped.Add(1)
+			continue
+		}
+		select {
+		case d.queue <- delivery{endpoint: endpoint, event: event}:
+		default:
+			d.dropped.Add(1)
+			slog.Warn("Webhook queue full, dropping event", "type", event.Type, "endpoint", endpoint)
+		}
+	}
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for job := range d.queue {
+		if err := d.deliver(job); err != nil {
+			d.failed.Add(1)
+			slog.Warn("Webhook delivery failed", "type", job.event.Type, "endpoint", job.endpoint, "error", err)
+			continue
+		}
+		d.delivered.Add(1)
+	}
+}
+
+// deliver POSTs one event, retrying network errors, 429 and 5xx responses
+// with exponential backoff.
+func (d *Dispatcher) deliver(job delivery) error {
+	body, err := json.Marshal(job.event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		retry, err := d.post(job, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry || attempt == d.maxAttempts {
+			break
+		}
+		select {
+		case <-time.After(d.backoff(attempt)):
+		case <-d.ctx.Done():
+			return fmt.Errorf("gave up on shutdown: %w", lastErr)
+		}
+	}
+	return lastErr
+}
+
+func (d *Dispatcher) post(job delivery, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, job.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cloud-docs-webhook")
+	req.Header.Set("X-Webhook-ID", job.event.ID)
+	req.Header.Set("X-Webhook-Event", job.event.Type)
+	req.Header.Set("X-Webhook-Signature", Sign(d.secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+}
+
+// backoff waits 1s, 2s, 4s, ... up to a minute, with 20% jitter so retries
+// from several instances don't arrive together.
+func backoff(attempt int) time.Duration {
+	wait := time.Second << (attempt - 1)
+	if wait > time.Minute || wait <= 0 {
+		wait = time.Minute
+	}
+	jitter := time.Duration(mathrand.Int64N(int64(wait) / 5))
+	return wait - wait/10 + jitter
+}
+
+// Sign returns the X-Webhook-Signature value "t=<unix>,v1=<hex>", where v1 is
+// the HMAC-SHA256 of "<unix>.<body>". Receivers should recompute it and
+// reject old timestamps to prevent replays.
+func Sign(secret []byte, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Close stops accepting events and waits for queued deliveries until ctx is
+// done, then abandons the rest.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return fmt.Errorf("abandoned pending webhooks: %w", ctx.Err())
+	}
+}
+
+func (d *Dispatcher) Stats() Stats {
+	return Stats{
+		Delivered: d.delivered.Load(),
+		Failed:    d.failed.Load(),
+		Dropped:   d.dropped.Load(),
+	}
+}
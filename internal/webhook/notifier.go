@@ -0,0 +1,102 @@
+package webhook
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/pavelanni/cloud-docs/internal/audit"
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+// maxSeenTokens bounds the memory used to detect a token's first use.
+const maxSeenTokens = 100000
+
+// Notifier turns requests and token validations into webhook events.
+type Notifier struct {
+	dispatcher *Dispatcher
+
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+func NewNotifier(dispatcher *Dispatcher) *Notifier {
+	return &Notifier{dispatcher: dispatcher, seen: map[string]struct{}{}}
+}
+
+// TokenHook reports expired and rejected tokens of tenant's site; pass it to
+// auth.WithTokenHook. Requests without a token are not reported.
+func (n *Notifier) TokenHook(tenant string) auth.TokenHook {
+	return func(r *http.Request, outcome string, t *token.Token) {
+		event := Event{Tenant: tenant, Path: r.URL.Path, RequestID: middleware.GetReqID(r.Context())}
+		switch outcome {
+		case auth.TokenExpired:
+			event.Type = TokenExpired
+			if t != nil {
+				event.TokenID, event.Subject = t.ID, t.Subject
+			}
+		case auth.TokenBadSignature, auth.TokenMalformed:
+			event.Type = TokenRejected
+		default:
+			return
+		}
+		n.dispatcher.Send(event)
+	}
+}
+
+// Middleware reports document views (see audit.IsView) on tenant's site,
+// and the first view with each token. It must run after the auth
+// middlewares.
+func (n *Notifier) Middleware(tenant string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return n.viewHandler(tenant, next)
+	}
+}
+
+func (n *Notifier) viewHandler(tenant string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// One PDF or video open issues many range requests; only the first
+		// counts
+		if !audit.IsView(r.Method, status, r.Header.Get("Range")) {
+			return
+		}
+
+		event := Event{Type: DocumentViewed, Tenant: tenant, Path: r.URL.Path, RequestID: middleware.GetReqID(r.Context())}
+		if t := auth.GetTokenFromContext(r.Context()); t != nil {
+			event.TokenID, event.Subject = t.ID, t.Subject
+		} else if id := auth.GetClientIdentityFromContext(r.Context()); id != nil {
+			event.Subject = id.Subject
+		}
+		n.dispatcher.Send(event)
+
+		if event.TokenID != "" && n.firstUse(event.TokenID) {
+			event.Type = TokenFirstUsed
+			n.dispatcher.Send(event)
+		}
+	})
+}
+
+// firstUse reports whether this instance hasn't seen tokenID before. Other
+// instances and restarts don't share this state, so receivers should
+// deduplicate token.first_used by token_id.
+func (n *Notifier) firstUse(tokenID string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.seen[tokenID]; ok {
+		return false
+	}
+	if len(n.seen) >= maxSeenTokens {
+		clear(n.seen)
+	}
+	n.seen[tokenID] = struct{}{}
+	return true
+}
@@ -0,0 +1,205 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pavelanni/cloud-docs/internal/auth"
+	"github.com/pavelanni/cloud-docs/pkg/token"
+)
+
+// receiver records deliveries and answers with the queued status codes,
+// then 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rv.mu.Lock()
+	defer rv.mu.Unlock()
+	status := http.StatusOK
+	if len(rv.statuses) > 0 {
+		status, rv.statuses = rv.statuses[0], rv.statuses[1:]
+	}
+	if status == http.StatusOK {
+		var e Event
+		json.Unmarshal(body, &e)
+		rv.events = append(rv.events, e)
+		rv.headers = append(rv.headers, r.Header.Clone())
+		rv.bodies = append(rv.bodies, body)
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(t *testing.T, rv *receiver, opts Options) *Dispatcher {
+	t.Helper()
+	server := httptest.NewServer(rv)
+	t.Cleanup(server.Close)
+	d := NewDispatcher([]string{server.URL}, "webhook-secret", opts)
+	d.backoff = func(int) time.Duration { return 0 }
+	return d
+}
+
+func TestDispatcherSignsEvents(t *testing.T) {
+	rv := &receiver{}
+	d := newTestDispatcher(t, rv, Options{})
+	d.Send(Event{Type: DocumentViewed, TokenID: "t1", Path: "/docs/a.html"})
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rv.events) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(rv.events))
+	}
+	e, h := rv.events[0], rv.headers[0]
+	if e.ID == "" || e.Time.IsZero() || e.TokenID != "t1" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if h.Get("X-Webhook-Event") != DocumentViewed || h.Get("X-Webhook-ID") != e.ID {
+		t.Errorf("Unexpected headers %v", h)
+	}
+
+	signature := h.Get("X-Webhook-Signature")
+	ts, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+	if want := Sign([]byte("webhook-secret"), time.Unix(ts, 0), rv.bodies[0]); signature != want {
+		t.Errorf("Signature %q does not verify, want %q", signature, want)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		statuses      []int
+		wantDelivered uint64
+		wantFailed    uint64
+	}{
+		{"server error then success", []int{500, 503}, 1, 0},
+		{"rate limited then success", []int{429}, 1, 0},
+		{"client error is final", []int{400}, 0, 1},
+		{"gives up after max attempts", []int{500, 500, 500}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rv := &receiver{statuses: tt.statuses}
+			d := newTestDispatcher(t, rv, Options{MaxAttempts: 3})
+			d.Send(Event{Type: TokenExpired})
+			d.Close(context.Background())
+
+			stats := d.Stats()
+			if stats.Delivered != tt.wantDelivered || stats.Failed != tt.wantFailed {
+				t.Errorf("Expected delivered=%d failed=%d, got %+v", tt.wantDelivered, tt.wantFailed, stats)
+			}
+		})
+	}
+}
+
+func TestDispatcherDropsWhenQueueFull(t *testing.T) {
+	gate := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-gate
+	}))
+	defer server.Close()
+
+	d := NewDispatcher([]string{server.URL}, "s", Options{QueueSize: 1, Workers: 1})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		d.Send(Event{Type: DocumentViewed})
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Send blocked on a full queue")
+	}
+	close(gate)
+	d.Close(context.Background())
+
+	// One in flight, one queued, the rest dropped
+	if stats := d.Stats(); stats.Dropped < 3 {
+		t.Errorf("Expected at least 3 dropped events, got %+v", stats)
+	}
+}
+
+func TestDispatcherEventFilter(t *testing.T) {
+	rv := &receiver{}
+	d := newTestDispatcher(t, rv, Options{Events: []string{TokenFirstUsed}})
+	d.Send(Event{Type: DocumentViewed})
+	d.Send(Event{Type: TokenFirstUsed})
+	d.Close(context.Background())
+
+	if len(rv.events) != 1 || rv.events[0].Type != TokenFirstUsed {
+		t.Errorf("Expected only token.first_used, got %+v", rv.events)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	rv := &receiver{}
+	d := newTestDispatcher(t, rv, Options{Workers: 1})
+	n := NewNotifier(d)
+
+	tokenManager := token.NewManager("test-secret")
+	validToken, _ := tokenManager.Generate(time.Hour, token.WithSubject("trial-acme"))
+	expiredToken, _ := tokenManager.Generate(-time.Hour, token.WithSubject("trial-acme"))
+
+	handler := auth.TokenMiddleware(tokenManager, auth.WithTokenHook(n.TokenHook("acme")))(
+		n.Middleware("acme")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "missing.html") {
+				http.NotFound(w, r)
+			}
+			if r.Header.Get("Range") != "" {
+				w.WriteHeader(http.StatusPartialContent)
+			}
+		})))
+
+	requests := []struct {
+		path        string
+		token       string
+		rangeHeader string
+	}{
+		{"/docs/a.html", validToken, ""},
+		{"/docs/b.html", validToken, ""},
+		{"/docs/missing.html", validToken, ""},
+		{"/docs/lecture.mp4", validToken, "bytes=0-"},
+		{"/docs/lecture.mp4", validToken, "bytes=1048576-"},
+		{"/docs/a.html", expiredToken, ""},
+		{"/docs/a.html", "garbage", ""},
+		{"/docs/a.html", "", ""},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest("GET", req.path, nil)
+		if req.token != "" {
+			r.Header.Set("Authorization", "Bearer "+req.token)
+		}
+		if req.rangeHeader != "" {
+			r.Header.Set("Range", req.rangeHeader)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	d.Close(context.Background())
+
+	var types []string
+	for _, e := range rv.events {
+		types = append(types, e.Type)
+		if e.Tenant != "acme" {
+			t.Errorf("Expected events to name the tenant, got %+v", e)
+		}
+		if e.Type == TokenExpired && e.Subject != "trial-acme" {
+			t.Errorf("Expected expired event to name the subject, got %+v", e)
+		}
+	}
+	want := []string{DocumentViewed, TokenFirstUsed, DocumentViewed, DocumentViewed, TokenExpired, TokenRejected}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected events %v, got %v", want, types)
+	}
+}
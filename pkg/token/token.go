@@ -5,7 +5,9 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,8 +19,46 @@ type Token struct {
 	ID        string    `json:"id"`
 	ExpiresAt time.Time `json:"expires_at"`
 	IssuedAt  time.Time `json:"issued_at"`
+	Subject   string    `json:"sub,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	Origins   []string  `json:"origins,omitempty"`
 }
 
+// Option sets an optional claim on a generated token.
+type Option func(*Token)
+
+// WithSubject records who the token was issued to (a learner, customer or portal).
+func WithSubject(subject string) Option {
+	return func(t *Token) {
+		t.Subject = subject
+	}
+}
+
+// WithRoles attaches roles that access policies can match against.
+func WithRoles(roles ...string) Option {
+	return func(t *Token) {
+		t.Roles = append(t.Roles, roles...)
+	}
+}
+
+// Validation errors, distinguishable with errors.Is.
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrBadSignature = errors.New("invalid token signature")
+	ErrExpired      = errors.New("token has expired")
+)
+
+// ExpiredError is returned for a correctly signed token past its expiry.
+// Its claims are authentic, so callers can still report who the token was
+// issued to. It matches ErrExpired with errors.Is.
+type ExpiredError struct {
+	Token *Token
+}
+
+func (e *ExpiredError) Error() string { return ErrExpired.Error() }
+
+func (e *ExpiredError) Is(target error) bool { return target == ErrExpired }
+
 type Manager struct {
 	secret []byte
 }
@@ -29,13 +69,37 @@ func NewManager(secret string) *Manager {
 	}
 }
 
-func (m *Manager) Generate(ttl time.Duration) (string, error) {
+// WithOrigins restricts the token to pages served from the given web origins
+// (e.g. "https://lms.example.com"), such as the customer's LMS.
+func WithOrigins(origins ...string) Option {
+	return func(t *Token) {
+		t.Origins = append(t.Origins, origins...)
+	}
+}
+
+var originPattern = regexp.MustCompile(`^https?://(\*\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*(:[0-9]{1,5})?$`)
+
+// ValidOrigin reports whether s is a web origin of the form scheme://host[:port].
+// The host may start with a "*." wildcard label to cover subdomains.
+func ValidOrigin(s string) bool {
+	return originPattern.MatchString(strings.ToLower(s))
+}
+
+func (m *Manager) Generate(ttl time.Duration, opts ...Option) (string, error) {
 	now := time.Now().UTC()
 	token := Token{
 		ID:        uuid.New().String(),
 		ExpiresAt: now.Add(ttl),
 		IssuedAt:  now,
 	}
+	for _, opt := range opts {
+		opt(&token)
+	}
+	for _, origin := range token.Origins {
+		if !ValidOrigin(origin) {
+			return "", fmt.Errorf("invalid origin %q: expected scheme://host[:port]", origin)
+		}
+	}
 
 	payload, err := json.Marshal(token)
 	if err != nil {
@@ -49,10 +113,12 @@ func (m *Manager) Generate(ttl time.Duration) (string, error) {
 	return fmt.Sprintf("%s.%s", encodedPayload, encodedSignature), nil
 }
 
+// Validate checks the token's signature and expiry. It returns a token only
+// when both are valid; an expired token's claims are in the *ExpiredError.
 func (m *Manager) Validate(tokenString string) (*Token, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid token format")
+		return nil, fmt.Errorf("%w: invalid token format", ErrMalformed)
 	}
 
 	encodedPayload := parts[0]
@@ -61,25 +127,25 @@ func (m *Manager) Validate(tokenString string) (*Token, error) {
 	expectedSignature := m.sign(encodedPayload)
 	providedSignature, err := base64.URLEncoding.DecodeString(encodedSignature)
 	if err != nil {
-		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+		return nil, fmt.Errorf("%w: invalid signature encoding: %v", ErrMalformed, err)
 	}
 
 	if !hmac.Equal(expectedSignature, providedSignature) {
-		return nil, fmt.Errorf("invalid token signature")
+		return nil, ErrBadSignature
 	}
 
 	payload, err := base64.URLEncoding.DecodeString(encodedPayload)
 	if err != nil {
-		return nil, fmt.Errorf("invalid payload encoding: %w", err)
+		return nil, fmt.Errorf("%w: invalid payload encoding: %v", ErrMalformed, err)
 	}
 
 	var token Token
 	if err := json.Unmarshal(payload, &token); err != nil {
-		return nil, fmt.Errorf("invalid token payload: %w", err)
+		return nil, fmt.Errorf("%w: invalid token payload: %v", ErrMalformed, err)
 	}
 
 	if time.Now().UTC().After(token.ExpiresAt) {
-		return nil, fmt.Errorf("token has expired")
+		return nil, &ExpiredError{Token: &token}
 	}
 
 	return &token, nil
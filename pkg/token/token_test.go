@@ -1,6 +1,7 @@
 package token
 
 import (
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -50,6 +51,76 @@ func TestManager_ValidateSuccess(t *testing.T) {
 	}
 }
 
+func TestManager_GenerateWithClaims(t *testing.T) {
+	manager := NewManager("test-secret")
+
+	tokenString, err := manager.Generate(time.Hour, WithSubject("acme-portal"), WithRoles("partner", "beta"))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	validToken, err := manager.Validate(tokenString)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+
+	if validToken.Subject != "acme-portal" {
+		t.Errorf("Expected subject %q, got %q", "acme-portal", validToken.Subject)
+	}
+
+	if len(validToken.Roles) != 2 || validToken.Roles[0] != "partner" || validToken.Roles[1] != "beta" {
+		t.Errorf("Expected roles [partner beta], got %v", validToken.Roles)
+	}
+}
+
+func TestManager_GenerateWithOrigins(t *testing.T) {
+	manager := NewManager("test-secret")
+
+	tokenString, err := manager.Generate(time.Hour, WithOrigins("https://lms.example.com", "https://*.academy.example:8443"))
+	if err != nil {
+		t.Fatalf("Failed to generate token: %v", err)
+	}
+
+	validToken, err := manager.Validate(tokenString)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+
+	if len(validToken.Origins) != 2 || validToken.Origins[0] != "https://lms.example.com" {
+		t.Errorf("Unexpected origins: %v", validToken.Origins)
+	}
+
+	if _, err := manager.Generate(time.Hour, WithOrigins("https://lms.example.com; script-src *")); err == nil {
+		t.Error("Expected error for invalid origin")
+	}
+}
+
+func TestValidOrigin(t *testing.T) {
+	tests := []struct {
+		origin   string
+		expected bool
+	}{
+		{"https://lms.example.com", true},
+		{"http://localhost:8080", true},
+		{"https://*.example.com", true},
+		{"HTTPS://LMS.Example.com", true},
+		{"lms.example.com", false},
+		{"https://lms.example.com/path", false},
+		{"https://lms.example.com 'unsafe-inline'", false},
+		{"ftp://files.example.com", false},
+		{"https://*", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if result := ValidOrigin(tt.origin); result != tt.expected {
+				t.Errorf("ValidOrigin(%q) = %v, want %v", tt.origin, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestManager_ValidateExpired(t *testing.T) {
 	manager := NewManager("test-secret")
 	
@@ -58,14 +129,24 @@ func TestManager_ValidateExpired(t *testing.T) {
 		t.Fatalf("Failed to generate token: %v", err)
 	}
 	
-	_, err = manager.Validate(tokenString)
+	expired, err := manager.Validate(tokenString)
 	if err == nil {
 		t.Error("Expected error for expired token")
 	}
+	if expired != nil {
+		t.Error("Expected no token for an expired token")
+	}
+	var expiredErr *ExpiredError
+	if !errors.As(err, &expiredErr) || expiredErr.Token.ID == "" {
+		t.Errorf("Expected ExpiredError with the token claims, got: %v", err)
+	}
 	
 	if !strings.Contains(err.Error(), "expired") {
 		t.Errorf("Expected 'expired' error, got: %v", err)
 	}
+	if !errors.Is(err, ErrExpired) {
+		t.Errorf("Expected ErrExpired, got: %v", err)
+	}
 }
 
 func TestManager_ValidateInvalidFormat(t *testing.T) {
@@ -84,6 +165,9 @@ func TestManager_ValidateInvalidFormat(t *testing.T) {
 			if err == nil {
 				t.Error("Expected error for invalid token format")
 			}
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("Expected ErrMalformed, got: %v", err)
+			}
 		})
 	}
 }
@@ -105,6 +189,9 @@ func TestManager_ValidateInvalidSignature(t *testing.T) {
 	if !strings.Contains(err.Error(), "signature") {
 		t.Errorf("Expected 'signature' error, got: %v", err)
 	}
+	if !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature, got: %v", err)
+	}
 }
 
 func TestParseDuration(t *testing.T) {
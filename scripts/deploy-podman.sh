@@ -24,6 +24,8 @@ BUCKET_NAME=${2:-""}
 TOKEN_SECRET=${3:-""}
 REGION=${4:-"us-central1"}
 SERVICE_NAME="cloud-docs-server"
+# Comma-separated origins allowed to embed documents, e.g. https://lms.example.com
+FRAME_ANCESTORS=${FRAME_ANCESTORS:-""}
 REGISTRY_NAME="cloud-docs"
 IMAGE_NAME="$REGION-docker.pkg.dev/$PROJECT_ID/$REGISTRY_NAME/$SERVICE_NAME"
 
@@ -36,6 +38,13 @@ if [ -z "$PROJECT_ID" ] || [ -z "$BUCKET_NAME" ] || [ -z "$TOKEN_SECRET" ]; then
     exit 1
 fi
 
+if [ -z "$FRAME_ANCESTORS" ]; then
+    echo "Set FRAME_ANCESTORS to the LMS origins that embed documents, e.g."
+    echo "  FRAME_ANCESTORS=https://lms.example.com $0 ..."
+    echo "Without it browsers refuse to show documents in a cross-origin iframe."
+    exit 1
+fi
+
 echo "Deploying via Artifact Registry (using Podman)..."
 echo "Project: $PROJECT_ID"
 echo "Registry: $REGISTRY_NAME"
@@ -81,7 +90,7 @@ gcloud run deploy $SERVICE_NAME \
     --region $REGION \
     --platform managed \
     --allow-unauthenticated \
-    --set-env-vars "BUCKET_NAME=$BUCKET_NAME,TOKEN_SECRET=$TOKEN_SECRET,DOCS_PATH=/docs" \
+    --set-env-vars "^@^APP_ENV=production@BUCKET_NAME=$BUCKET_NAME@TOKEN_SECRET=$TOKEN_SECRET@DOCS_PATH=/docs@FRAME_ANCESTORS=$FRAME_ANCESTORS" \
     --memory 512Mi \
     --cpu 1 \
     --timeout 300 \
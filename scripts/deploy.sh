@@ -20,6 +20,8 @@ BUCKET_NAME=${2:-""}
 TOKEN_SECRET=${3:-""}
 REGION=${4:-"us-central1"}
 SERVICE_NAME="cloud-docs-server"
+# Comma-separated origins allowed to embed documents, e.g. https://lms.example.com
+FRAME_ANCESTORS=${FRAME_ANCESTORS:-""}
 
 # Check required parameters
 if [ -z "$PROJECT_ID" ] || [ -z "$BUCKET_NAME" ] || [ -z "$TOKEN_SECRET" ]; then
@@ -35,6 +37,16 @@ if [ -z "$PROJECT_ID" ] || [ -z "$BUCKET_NAME" ] || [ -z "$TOKEN_SECRET" ]; then
     echo ""
     echo "Optional:"
     echo "  REGION        - GCP region (default: us-central1)"
+    echo ""
+    echo "Environment:"
+    echo "  FRAME_ANCESTORS - Origins allowed to embed documents (required)"
+    exit 1
+fi
+
+if [ -z "$FRAME_ANCESTORS" ]; then
+    echo "Set FRAME_ANCESTORS to the LMS origins that embed documents, e.g."
+    echo "  FRAME_ANCESTORS=https://lms.example.com $0 ..."
+    echo "Without it browsers refuse to show documents in a cross-origin iframe."
     exit 1
 fi
 
@@ -51,7 +63,7 @@ gcloud config set project $PROJECT_ID
 # Build and deploy using Cloud Build
 gcloud builds submit . \
     --config cloudbuild.yaml \
-    --substitutions _BUCKET_NAME=$BUCKET_NAME,_TOKEN_SECRET=$TOKEN_SECRET,_REGION=$REGION
+    --substitutions "^@^_BUCKET_NAME=$BUCKET_NAME@_TOKEN_SECRET=$TOKEN_SECRET@_REGION=$REGION@_FRAME_ANCESTORS=$FRAME_ANCESTORS"
 
 echo ""
 echo "Deployment complete!"